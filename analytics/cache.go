@@ -0,0 +1,41 @@
+package analytics
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache keeps reports for TTL so repeated requests don't reload and reanalyse the whole graph
+type Cache struct {
+	TTL time.Duration
+
+	mu      sync.Mutex
+	reports map[string]*Report
+}
+
+// NewCache creates an empty cache, a TTL of zero keeps reports until they are refreshed
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{TTL: ttl, reports: make(map[string]*Report)}
+}
+
+// Get returns the report cached under key, calling compute when there is none, it has expired or refresh is set
+func (c *Cache) Get(key string, refresh bool, compute func() (*Report, error)) (*Report, error) {
+	c.mu.Lock()
+	report, ok := c.reports[key]
+	c.mu.Unlock()
+
+	if ok && !refresh && (c.TTL == 0 || time.Since(report.ComputedAt) < c.TTL) {
+		return report, nil
+	}
+
+	report, err := compute()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.reports[key] = report
+	c.mu.Unlock()
+
+	return report, nil
+}
@@ -0,0 +1,62 @@
+package analytics
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	computed := 0
+	compute := func() (*Report, error) {
+		computed++
+		return &Report{ComputedAt: time.Now()}, nil
+	}
+
+	cache := NewCache(time.Hour)
+
+	first, err := cache.Get("north", false, compute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := cache.Get("north", false, compute); again != first || computed != 1 {
+		t.Errorf("a fresh report was computed again, %d computations", computed)
+	}
+	if _, _ = cache.Get("south", false, compute); computed != 2 {
+		t.Errorf("another key shared a report, %d computations", computed)
+	}
+	if refreshed, _ := cache.Get("north", true, compute); refreshed == first || computed != 3 {
+		t.Errorf("refresh did not compute again, %d computations", computed)
+	}
+
+	// A failed computation keeps the report there was
+	failure := errors.New("database unavailable")
+	if _, err := cache.Get("north", true, func() (*Report, error) { return nil, failure }); !errors.Is(err, failure) {
+		t.Errorf("Get() error = %v, want %v", err, failure)
+	}
+	if _, err := cache.Get("north", false, compute); err != nil || computed != 3 {
+		t.Errorf("the previous report was lost, %d computations", computed)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	computed := 0
+	compute := func() (*Report, error) {
+		computed++
+		return &Report{ComputedAt: time.Now().Add(-time.Minute)}, nil
+	}
+
+	expiring := NewCache(time.Second)
+	_, _ = expiring.Get("north", false, compute)
+	_, _ = expiring.Get("north", false, compute)
+	if computed != 2 {
+		t.Errorf("an expired report was reused, %d computations", computed)
+	}
+
+	forever := NewCache(0)
+	_, _ = forever.Get("north", false, compute)
+	_, _ = forever.Get("north", false, compute)
+	if computed != 3 {
+		t.Errorf("a cache without a TTL recomputed, %d computations", computed)
+	}
+}
@@ -0,0 +1,248 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+)
+
+// Edge links two nodes by their ids, the direction is ignored by every measure
+type Edge struct {
+	From string
+	To   string
+	Type string
+}
+
+// Graph is a snapshot of nodes and the edges between them held in memory,
+// the measures work the same whichever store it was loaded from
+type Graph struct {
+	Nodes []string
+	Edges []Edge
+	// Properties of each node, carried into the report so its ids can be shown without another lookup
+	Properties map[string]map[string]string
+}
+
+// Score is the degree centrality of a node, Centrality is Degree divided by the number of other nodes
+type Score struct {
+	Node       string
+	Degree     int
+	Centrality float64
+}
+
+// Report is every measure computed from one snapshot
+type Report struct {
+	ComputedAt  time.Time
+	NodeCount   int
+	EdgeCount   int
+	Properties  map[string]map[string]string
+	Centrality  []Score
+	Components  [][]string
+	Communities [][]string
+	Isolated    []string
+}
+
+// maxMovingRounds bounds community detection, it normally settles in a handful of rounds
+const maxMovingRounds = 20
+
+// Analyse computes every measure of g
+func Analyse(g *Graph) *Report {
+	adjacency := g.adjacency()
+
+	return &Report{
+		ComputedAt:  time.Now(),
+		NodeCount:   len(g.Nodes),
+		EdgeCount:   len(g.Edges),
+		Properties:  g.Properties,
+		Centrality:  degreeCentrality(adjacency),
+		Components:  components(adjacency),
+		Communities: communities(adjacency),
+		Isolated:    isolated(adjacency),
+	}
+}
+
+// adjacency returns each node's distinct neighbours, edges to nodes outside the snapshot and loops are dropped
+func (g *Graph) adjacency() map[string]map[string]bool {
+	adjacency := make(map[string]map[string]bool, len(g.Nodes))
+	for _, node := range g.Nodes {
+		adjacency[node] = make(map[string]bool)
+	}
+
+	for _, edge := range g.Edges {
+		from, fromOk := adjacency[edge.From]
+		to, toOk := adjacency[edge.To]
+		if !fromOk || !toOk || edge.From == edge.To {
+			continue
+		}
+		from[edge.To] = true
+		to[edge.From] = true
+	}
+
+	return adjacency
+}
+
+// degreeCentrality scores every node by its number of distinct neighbours, highest first
+func degreeCentrality(adjacency map[string]map[string]bool) []Score {
+	scores := make([]Score, 0, len(adjacency))
+	others := float64(len(adjacency) - 1)
+
+	for node, neighbours := range adjacency {
+		score := Score{Node: node, Degree: len(neighbours)}
+		if others > 0 {
+			score.Centrality = float64(score.Degree) / others
+		}
+		scores = append(scores, score)
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Degree != scores[j].Degree {
+			return scores[i].Degree > scores[j].Degree
+		}
+		return scores[i].Node < scores[j].Node
+	})
+
+	return scores
+}
+
+// components returns the connected components, largest first
+func components(adjacency map[string]map[string]bool) [][]string {
+	seen := make(map[string]bool, len(adjacency))
+	var groups [][]string
+
+	for _, start := range sortedNodes(adjacency) {
+		if seen[start] {
+			continue
+		}
+
+		seen[start] = true
+		group := []string{start}
+		for next := 0; next < len(group); next++ {
+			for neighbour := range adjacency[group[next]] {
+				if !seen[neighbour] {
+					seen[neighbour] = true
+					group = append(group, neighbour)
+				}
+			}
+		}
+
+		groups = append(groups, group)
+	}
+
+	return sortGroups(groups)
+}
+
+// communities detects densely connected groups with the local moving phase of the Louvain method, every node
+// repeatedly joins the neighbouring community that raises modularity the most. Nodes are visited in id order
+// and ties go to the current or else the smallest community so the result only depends on the snapshot.
+func communities(adjacency map[string]map[string]bool) [][]string {
+	nodes := sortedNodes(adjacency)
+
+	// Twice the number of edges, every edge is in the adjacency of both its nodes
+	twiceEdges := 0
+	community := make(map[string]string, len(nodes))
+	total := make(map[string]int, len(nodes))
+	for _, node := range nodes {
+		twiceEdges += len(adjacency[node])
+		community[node] = node
+		total[node] = len(adjacency[node])
+	}
+
+	if twiceEdges == 0 {
+		return sortGroups(singletons(nodes))
+	}
+
+	for round := 0; round < maxMovingRounds; round++ {
+		moved := false
+
+		for _, node := range nodes {
+			degree := len(adjacency[node])
+			if degree == 0 {
+				continue
+			}
+
+			current := community[node]
+			total[current] -= degree
+
+			links := make(map[string]int)
+			for neighbour := range adjacency[node] {
+				links[community[neighbour]]++
+			}
+
+			// Modularity gain of joining c, scaled by the number of edges
+			gain := func(c string) float64 {
+				return float64(links[c]) - float64(total[c])*float64(degree)/float64(twiceEdges)
+			}
+
+			best, bestGain := current, gain(current)
+			for c := range links {
+				if g := gain(c); g > bestGain || (g == bestGain && best != current && c < best) {
+					best, bestGain = c, g
+				}
+			}
+
+			community[node] = best
+			total[best] += degree
+			if best != current {
+				moved = true
+			}
+		}
+
+		if !moved {
+			break
+		}
+	}
+
+	byCommunity := make(map[string][]string)
+	for _, node := range nodes {
+		byCommunity[community[node]] = append(byCommunity[community[node]], node)
+	}
+
+	groups := make([][]string, 0, len(byCommunity))
+	for _, group := range byCommunity {
+		groups = append(groups, group)
+	}
+
+	return sortGroups(groups)
+}
+
+// singletons puts every node in a group of its own
+func singletons(nodes []string) [][]string {
+	groups := make([][]string, len(nodes))
+	for index, node := range nodes {
+		groups[index] = []string{node}
+	}
+	return groups
+}
+
+// isolated returns the nodes without any neighbours
+func isolated(adjacency map[string]map[string]bool) []string {
+	var nodes []string
+	for _, node := range sortedNodes(adjacency) {
+		if len(adjacency[node]) == 0 {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// sortedNodes returns the node ids in order
+func sortedNodes(adjacency map[string]map[string]bool) []string {
+	nodes := make([]string, 0, len(adjacency))
+	for node := range adjacency {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// sortGroups orders each group's ids and the groups largest first
+func sortGroups(groups [][]string) [][]string {
+	for _, group := range groups {
+		sort.Strings(group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i]) != len(groups[j]) {
+			return len(groups[i]) > len(groups[j])
+		}
+		return groups[i][0] < groups[j][0]
+	})
+	return groups
+}
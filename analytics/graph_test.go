@@ -0,0 +1,108 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+)
+
+// twoTriangles is two triangles joined by the bridge c-d, with e isolated
+func twoTriangles() *Graph {
+	return &Graph{
+		Nodes: []string{"a", "b", "c", "d", "e", "f", "g"},
+		Edges: []Edge{
+			{From: "a", To: "b"}, {From: "b", To: "c"}, {From: "c", To: "a"},
+			{From: "d", To: "f"}, {From: "f", To: "g"}, {From: "g", To: "d"},
+			{From: "c", To: "d"},
+		},
+	}
+}
+
+func TestAnalyse(t *testing.T) {
+	tests := []struct {
+		name            string
+		graph           *Graph
+		wantComponents  [][]string
+		wantCommunities [][]string
+		wantIsolated    []string
+	}{
+		{
+			name:            "empty",
+			graph:           &Graph{},
+			wantComponents:  nil,
+			wantCommunities: [][]string{},
+		},
+		{
+			name:            "no edges",
+			graph:           &Graph{Nodes: []string{"b", "a"}},
+			wantComponents:  [][]string{{"a"}, {"b"}},
+			wantCommunities: [][]string{{"a"}, {"b"}},
+			wantIsolated:    []string{"a", "b"},
+		},
+		{
+			name:            "bridged triangles",
+			graph:           twoTriangles(),
+			wantComponents:  [][]string{{"a", "b", "c", "d", "f", "g"}, {"e"}},
+			wantCommunities: [][]string{{"a", "b", "c"}, {"d", "f", "g"}, {"e"}},
+			wantIsolated:    []string{"e"},
+		},
+		{
+			name: "loops, duplicates and edges leaving the snapshot are ignored",
+			graph: &Graph{
+				Nodes: []string{"a", "b"},
+				Edges: []Edge{{From: "a", To: "a"}, {From: "a", To: "b"}, {From: "b", To: "a"}, {From: "a", To: "z"}},
+			},
+			wantComponents:  [][]string{{"a", "b"}},
+			wantCommunities: [][]string{{"a", "b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Analyse(tt.graph)
+
+			if !reflect.DeepEqual(report.Components, tt.wantComponents) {
+				t.Errorf("Components = %v, want %v", report.Components, tt.wantComponents)
+			}
+			if !reflect.DeepEqual(report.Communities, tt.wantCommunities) {
+				t.Errorf("Communities = %v, want %v", report.Communities, tt.wantCommunities)
+			}
+			if !reflect.DeepEqual(report.Isolated, tt.wantIsolated) {
+				t.Errorf("Isolated = %v, want %v", report.Isolated, tt.wantIsolated)
+			}
+			if report.NodeCount != len(tt.graph.Nodes) || report.EdgeCount != len(tt.graph.Edges) {
+				t.Errorf("counts = %d nodes %d edges", report.NodeCount, report.EdgeCount)
+			}
+		})
+	}
+}
+
+func TestDegreeCentrality(t *testing.T) {
+	report := Analyse(twoTriangles())
+
+	want := []Score{
+		{Node: "c", Degree: 3, Centrality: 0.5},
+		{Node: "d", Degree: 3, Centrality: 0.5},
+		{Node: "a", Degree: 2, Centrality: 2.0 / 6},
+		{Node: "b", Degree: 2, Centrality: 2.0 / 6},
+		{Node: "f", Degree: 2, Centrality: 2.0 / 6},
+		{Node: "g", Degree: 2, Centrality: 2.0 / 6},
+		{Node: "e", Degree: 0, Centrality: 0},
+	}
+	if !reflect.DeepEqual(report.Centrality, want) {
+		t.Errorf("Centrality = %v, want %v", report.Centrality, want)
+	}
+
+	single := Analyse(&Graph{Nodes: []string{"a"}})
+	if single.Centrality[0].Centrality != 0 {
+		t.Errorf("a lone node has centrality %v", single.Centrality[0].Centrality)
+	}
+}
+
+func TestCommunitiesAreRepeatable(t *testing.T) {
+	first := Analyse(twoTriangles()).Communities
+	for i := 0; i < 20; i++ {
+		if got := Analyse(twoTriangles()).Communities; !reflect.DeepEqual(got, first) {
+			t.Fatalf("Communities = %v, then %v", first, got)
+		}
+	}
+}
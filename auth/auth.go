@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"gql/database"
+	"gql/graph/model"
+	"net/http"
+	"strings"
+)
+
+// Caller is the authenticated user making a request
+type Caller struct {
+	ID          string
+	Institution string
+	Role        model.UserType
+}
+
+type callerKey struct{}
+
+// ForContext returns the caller stored by Middleware, nil for an anonymous request
+func ForContext(ctx context.Context) *Caller {
+	caller, _ := ctx.Value(callerKey{}).(*Caller)
+	return caller
+}
+
+// IsSuperAdmin reports whether the caller may work across institutions
+func (c *Caller) IsSuperAdmin() bool {
+	return c != nil && c.Role == model.UserTypeSuperAdmin
+}
+
+// IsAdmin reports whether the caller administers their institution, super admins included
+func (c *Caller) IsAdmin() bool {
+	return c != nil && (c.Role == model.UserTypeAdmin || c.IsSuperAdmin())
+}
+
+// Middleware authenticates bearer tokens signed with secret and scopes the database to the caller's institution.
+// When secret is empty authentication is off and every request is scoped to defaultInstitution, which
+// is only meant for single college and development deployments.
+func Middleware(secret []byte, defaultInstitution string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if len(secret) == 0 {
+			ctx = database.WithScope(ctx, database.Scope{Institution: defaultInstitution})
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		// Anonymous requests have no scope so the database layer refuses every query they make
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := ParseToken(token, secret)
+		if err != nil {
+			http.Error(w, "invalid bearer token: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		caller := &Caller{ID: claims.Subject, Institution: claims.Institution, Role: model.UserType(claims.Role)}
+		if !caller.Role.IsValid() || (caller.Institution == "" && !caller.IsSuperAdmin()) {
+			http.Error(w, "bearer token must carry a valid role and an institution", http.StatusUnauthorized)
+			return
+		}
+
+		ctx = context.WithValue(ctx, callerKey{}, caller)
+		ctx = database.WithScope(ctx, database.Scope{Institution: caller.Institution, AllInstitutions: caller.IsSuperAdmin()})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
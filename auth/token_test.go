@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"gql/database"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("test secret")
+
+// sign builds a token from a header and claims, signed with HS256 whatever the header says
+func sign(t *testing.T, header, claims map[string]interface{}, secret []byte) string {
+	t.Helper()
+
+	encode := func(value interface{}) string {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	unsigned := encode(header) + "." + encode(claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// withSignature replaces the signature of token
+func withSignature(token, signature string) string {
+	return token[:strings.LastIndex(token, ".")+1] + signature
+}
+
+// validClaims are claims ParseToken and Middleware accept, changed by each case
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":         "u1",
+		"institution": "north",
+		"role":        "TUTOR",
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+var hs256 = map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+
+func TestParseToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   func(t *testing.T) string
+		wantErr bool
+	}{
+		{"valid", func(t *testing.T) string {
+			return sign(t, hs256, validClaims(), testSecret)
+		}, false},
+		{"other algorithm", func(t *testing.T) string {
+			return sign(t, map[string]interface{}{"alg": "HS512"}, validClaims(), testSecret)
+		}, true},
+		{"algorithm none", func(t *testing.T) string {
+			return withSignature(sign(t, map[string]interface{}{"alg": "none"}, validClaims(), testSecret), "")
+		}, true},
+		{"other secret", func(t *testing.T) string {
+			return sign(t, hs256, validClaims(), []byte("other secret"))
+		}, true},
+		{"tampered claims", func(t *testing.T) string {
+			token := sign(t, hs256, validClaims(), testSecret)
+			claims := validClaims()
+			claims["role"] = "SUPER_ADMIN"
+			forged := sign(t, hs256, claims, testSecret)
+			return withSignature(forged, token[strings.LastIndex(token, ".")+1:])
+		}, true},
+		{"expired", func(t *testing.T) string {
+			claims := validClaims()
+			claims["exp"] = time.Now().Add(-time.Minute).Unix()
+			return sign(t, hs256, claims, testSecret)
+		}, true},
+		{"no expiry", func(t *testing.T) string {
+			claims := validClaims()
+			delete(claims, "exp")
+			return sign(t, hs256, claims, testSecret)
+		}, true},
+		{"no subject", func(t *testing.T) string {
+			claims := validClaims()
+			delete(claims, "sub")
+			return sign(t, hs256, claims, testSecret)
+		}, true},
+		{"two parts", func(t *testing.T) string {
+			return "e30.e30"
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseToken(tt.token(t), testSecret)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (claims.Subject != "u1" || claims.Institution != "north" || claims.Role != "TUTOR") {
+				t.Errorf("ParseToken() = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	withClaims := func(change func(claims map[string]interface{})) string {
+		claims := validClaims()
+		change(claims)
+		return "Bearer " + sign(t, hs256, claims, testSecret)
+	}
+
+	tests := []struct {
+		name          string
+		secret        []byte
+		authorization string
+		wantStatus    int
+		wantCaller    bool
+		wantScope     bool
+	}{
+		{"authentication off", nil, "", http.StatusOK, false, true},
+		{"anonymous passes unscoped", testSecret, "", http.StatusOK, false, false},
+		{"valid token", testSecret, withClaims(func(map[string]interface{}) {}), http.StatusOK, true, true},
+		{"invalid token", testSecret, "Bearer not.a.token", http.StatusUnauthorized, false, false},
+		{"no institution", testSecret, withClaims(func(claims map[string]interface{}) { delete(claims, "institution") }), http.StatusUnauthorized, false, false},
+		{"super admin without institution", testSecret, withClaims(func(claims map[string]interface{}) {
+			delete(claims, "institution")
+			claims["role"] = "SUPER_ADMIN"
+		}), http.StatusOK, true, true},
+		{"no role", testSecret, withClaims(func(claims map[string]interface{}) { delete(claims, "role") }), http.StatusUnauthorized, false, false},
+		{"unknown role", testSecret, withClaims(func(claims map[string]interface{}) { claims["role"] = "JANITOR" }), http.StatusUnauthorized, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached := false
+			var caller *Caller
+			scoped := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+				caller = ForContext(r.Context())
+				_, scoped = database.ScopeOf(r.Context())
+			})
+
+			request := httptest.NewRequest("POST", "/query", nil)
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			Middleware(tt.secret, "default", next).ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if reached {
+					t.Errorf("a rejected request reached the handler")
+				}
+				return
+			}
+			if (caller != nil) != tt.wantCaller {
+				t.Errorf("caller = %+v, want one %v", caller, tt.wantCaller)
+			}
+			if scoped != tt.wantScope {
+				t.Errorf("scoped = %v, want %v", scoped, tt.wantScope)
+			}
+		})
+	}
+}
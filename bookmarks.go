@@ -0,0 +1,58 @@
+package main
+
+import (
+	"gql/database"
+	"net/http"
+	"strings"
+)
+
+/* Clients send the bookmarks from their last response to read their own writes on any cluster member */
+const bookmarkHeader = "Neo4j-Bookmark"
+
+/* Sets the bookmark header just before the response is written, once the request's writes are known */
+type bookmarkResponseWriter struct {
+	http.ResponseWriter
+	request     *http.Request
+	wroteHeader bool
+}
+
+func (w *bookmarkResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		for _, bookmark := range database.Bookmarks(w.request.Context()) {
+			w.Header().Add(bookmarkHeader, bookmark)
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *bookmarkResponseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+/* Reads bookmarks from the request into the database context and returns the latest ones in the response */
+func bookmarkMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var bookmarks []string
+		for _, value := range r.Header.Values(bookmarkHeader) {
+			for _, bookmark := range strings.Split(value, ",") {
+				if bookmark = strings.TrimSpace(bookmark); bookmark != "" {
+					bookmarks = append(bookmarks, bookmark)
+				}
+			}
+		}
+
+		r = r.WithContext(database.WithBookmarks(r.Context(), bookmarks))
+
+		// Websocket upgrades need the original writer to hijack the connection
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(&bookmarkResponseWriter{ResponseWriter: w, request: r}, r)
+	})
+}
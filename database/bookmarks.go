@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"sync"
+)
+
+// bookmarkState holds the causal chain for one request, the bookmarks the client sent and those
+// produced by the request's own writes
+type bookmarkState struct {
+	mu        sync.Mutex
+	bookmarks []string
+}
+
+type bookmarkKey struct{}
+
+// WithBookmarks starts tracking bookmarks for a request, every transaction run with the returned context
+// waits until the database has caught up with the given bookmarks and with the request's earlier writes
+func WithBookmarks(ctx context.Context, bookmarks []string) context.Context {
+	return context.WithValue(ctx, bookmarkKey{}, &bookmarkState{bookmarks: bookmarks})
+}
+
+// Bookmarks returns the bookmarks a later request should send to read the writes made with ctx
+func Bookmarks(ctx context.Context) []string {
+	state, ok := ctx.Value(bookmarkKey{}).(*bookmarkState)
+	if !ok {
+		return nil
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	return append([]string(nil), state.bookmarks...)
+}
+
+// recordBookmark replaces the request's bookmarks after a write, the new bookmark follows all of them
+func recordBookmark(ctx context.Context, bookmark string) {
+	state, ok := ctx.Value(bookmarkKey{}).(*bookmarkState)
+	if !ok || bookmark == "" {
+		return
+	}
+
+	state.mu.Lock()
+	state.bookmarks = []string{bookmark}
+	state.mu.Unlock()
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Endpoint constrains one end of a relationship type to nodes of Label whose Property is one of Values
+type Endpoint struct {
+	Label    string
+	Property string
+	// Values empty allows any node of the label
+	Values []string
+}
+
+// RelationshipType declares a relationship that may be created between nodes.
+// The limits count edges of the type whose validity overlaps the new one, zero is unlimited.
+type RelationshipType struct {
+	Name string
+	From Endpoint
+	To   Endpoint
+	// MaxPerFrom caps the edges a From node may have, MaxPerTo the edges a To node may have
+	MaxPerFrom int
+	MaxPerTo   int
+}
+
+// catalogue of relationship types, guarded by registryMu with the labels
+var catalogue = make(map[string]RelationshipType)
+
+// RegisterRelationshipType adds a relationship type to the catalogue, only catalogued types can be created
+func RegisterRelationshipType(relationshipType RelationshipType) error {
+	if !relationshipTypePattern.MatchString(relationshipType.Name) {
+		return fmt.Errorf("invalid relationship type name %q", relationshipType.Name)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, endpoint := range []Endpoint{relationshipType.From, relationshipType.To} {
+		label, ok := registry[endpoint.Label]
+		if !ok {
+			return fmt.Errorf("relationship type %s uses unregistered label %s", relationshipType.Name, endpoint.Label)
+		}
+		if _, ok := label.property(endpoint.Property); !ok && (endpoint.Property != "" || len(endpoint.Values) > 0) {
+			return fmt.Errorf("relationship type %s constrains unknown property %s of %s", relationshipType.Name, endpoint.Property, endpoint.Label)
+		}
+	}
+
+	if _, ok := catalogue[relationshipType.Name]; ok {
+		return fmt.Errorf("relationship type %s is already registered", relationshipType.Name)
+	}
+	catalogue[relationshipType.Name] = relationshipType
+
+	return nil
+}
+
+// MustRegisterRelationshipType is RegisterRelationshipType for package level declarations, it panics on an invalid type
+func MustRegisterRelationshipType(relationshipType RelationshipType) RelationshipType {
+	if err := RegisterRelationshipType(relationshipType); err != nil {
+		panic(err)
+	}
+	return relationshipType
+}
+
+// LookupRelationshipType returns the catalogue entry of a relationship type
+func LookupRelationshipType(name string) (RelationshipType, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	relationshipType, ok := catalogue[name]
+	return relationshipType, ok
+}
+
+// checkLabels makes sure an edge of the type can link nodes of these labels
+func (t RelationshipType) checkLabels(from, to Label) error {
+	if t.From.Label != from.Name || t.To.Label != to.Name {
+		return invalid("%s must go from a %s to a %s", t.Name, t.From.Label, t.To.Label)
+	}
+	return nil
+}
+
+// checkEndpoints validates the property values of the two nodes and the overlapping edges each already has
+func (t RelationshipType) checkEndpoints(fromValue, toValue string, fromCount, toCount int64) error {
+	if !t.From.allows(fromValue) {
+		return invalid("%s must go from a %s with %s %s, not %s", t.Name, t.From.Label, t.From.Property, strings.Join(t.From.Values, " or "), fromValue)
+	}
+	if !t.To.allows(toValue) {
+		return invalid("%s must go to a %s with %s %s, not %s", t.Name, t.To.Label, t.To.Property, strings.Join(t.To.Values, " or "), toValue)
+	}
+	if t.MaxPerFrom > 0 && fromCount >= int64(t.MaxPerFrom) {
+		return invalid("a %s may have at most %d %s relationships at a time", t.From.Label, t.MaxPerFrom, t.Name)
+	}
+	if t.MaxPerTo > 0 && toCount >= int64(t.MaxPerTo) {
+		return invalid("a %s may be the target of at most %d %s relationships at a time", t.To.Label, t.MaxPerTo, t.Name)
+	}
+	return nil
+}
+
+// allows reports whether a node with value for the endpoint property may be at this end
+func (e Endpoint) allows(value string) bool {
+	if len(e.Values) == 0 {
+		return true
+	}
+	for _, allowed := range e.Values {
+		if value == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// propertyExpression returns the Cypher for the endpoint property of alias, null when nothing is constrained
+func (e Endpoint) propertyExpression(alias string) string {
+	if e.Property == "" {
+		return "null"
+	}
+	return alias + "." + e.Property
+}
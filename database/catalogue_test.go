@@ -0,0 +1,60 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckEndpoints(t *testing.T) {
+	personalTutor := RelationshipType{
+		Name:     "PERSONAL_TUTOR",
+		From:     Endpoint{Label: "User", Property: "userType", Values: []string{"TUTOR", "ADMIN"}},
+		To:       Endpoint{Label: "User", Property: "userType", Values: []string{"STUDENT"}},
+		MaxPerTo: 1,
+	}
+	unconstrained := RelationshipType{Name: "KNOWS", From: Endpoint{Label: "User"}, To: Endpoint{Label: "User"}}
+
+	tests := []struct {
+		name             string
+		relationshipType RelationshipType
+		fromValue        string
+		toValue          string
+		fromCount        int64
+		toCount          int64
+		wantErr          bool
+	}{
+		{"allowed", personalTutor, "TUTOR", "STUDENT", 5, 0, false},
+		{"second allowed from value", personalTutor, "ADMIN", "STUDENT", 0, 0, false},
+		{"wrong from value", personalTutor, "STUDENT", "STUDENT", 0, 0, true},
+		{"wrong to value", personalTutor, "TUTOR", "TUTOR", 0, 0, true},
+		{"to limit reached", personalTutor, "TUTOR", "STUDENT", 0, 1, true},
+		{"no limits or values", unconstrained, "", "", 100, 100, false},
+		{"from limit reached", RelationshipType{Name: "MENTORS", MaxPerFrom: 2}, "", "", 2, 0, true},
+		{"from limit not reached", RelationshipType{Name: "MENTORS", MaxPerFrom: 2}, "", "", 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.relationshipType.checkEndpoints(tt.fromValue, tt.toValue, tt.fromCount, tt.toCount)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkEndpoints() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var validationErr *ValidationError
+			if err != nil && !errors.As(err, &validationErr) {
+				t.Errorf("checkEndpoints() error = %v, want a ValidationError", err)
+			}
+		})
+	}
+}
+
+func TestCheckLabels(t *testing.T) {
+	tutors := RelationshipType{Name: "TUTORS", From: Endpoint{Label: "User"}, To: Endpoint{Label: "User"}}
+
+	if err := tutors.checkLabels(Label{Name: "User"}, Label{Name: "User"}); err != nil {
+		t.Errorf("checkLabels() error = %v", err)
+	}
+	if err := tutors.checkLabels(Label{Name: "User"}, Label{Name: "Group"}); err == nil {
+		t.Errorf("checkLabels() accepted the wrong label")
+	}
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// EnsureConstraints creates the uniqueness constraints and indexes the package relies on when they don't exist yet,
+// the key of every registered label is unique across institutions and so is the id of every idempotency key.
+// The versions of a node are looked up by its label and key, expired idempotency keys by their expiry.
+// Call once at start up, after CreateDriver and once every label is registered.
+// It fails when existing nodes already break a constraint.
+func EnsureConstraints(ctx context.Context) error {
+	registryMu.RLock()
+	statements := []string{
+		uniqueConstraint(idempotencyLabel, "id"),
+		index(versionLabel, "nodeLabel", "nodeKey"),
+		index(idempotencyLabel, "expiresAt"),
+	}
+	for _, label := range registry {
+		statements = append(statements, uniqueConstraint(label.Name, label.Key))
+	}
+	registryMu.RUnlock()
+
+	for _, statement := range statements {
+		if _, err := recordsFromDB(ctx, "ensureConstraints", neo4j.AccessModeWrite, statement, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// assignBatchSize is the most nodes AssignInstitution tags per transaction, keeping each within the query timeout
+const assignBatchSize = 10000
+
+// AssignInstitution tags the nodes of every registered label written before nodes were scoped, which have no
+// institution and so are invisible to every scoped query, as belonging to institution. It returns how many it
+// tagged. Call once at start up after EnsureConstraints, each batch runs as a transaction of its own.
+func AssignInstitution(ctx context.Context, institution string) (int64, error) {
+	registryMu.RLock()
+	labels := make([]string, 0, len(registry))
+	for _, label := range registry {
+		labels = append(labels, label.Name)
+	}
+	registryMu.RUnlock()
+
+	var assigned int64
+	for _, label := range labels {
+		query := "MATCH (n:" + label + ") WHERE n." + InstitutionProperty + " IS NULL" +
+			" WITH n LIMIT $limit SET n." + InstitutionProperty + " = $institution RETURN count(n)"
+		queryData := map[string]interface{}{"institution": institution, "limit": assignBatchSize}
+
+		for {
+			records, err := recordsFromDB(ctx, "assignInstitution", neo4j.AccessModeWrite, query, queryData)
+			if err != nil {
+				return assigned, err
+			}
+			count := records[0].Values[0].(int64)
+			assigned += count
+			if count < assignBatchSize {
+				break
+			}
+		}
+	}
+
+	return assigned, nil
+}
+
+// uniqueConstraint is the statement making property unique among the nodes of label, in the FOR ... REQUIRE
+// form understood by Neo4j 4.4 and 5 alike
+func uniqueConstraint(label, property string) string {
+	return "CREATE CONSTRAINT " + strings.ToLower(label) + "_" + property + "_unique IF NOT EXISTS" +
+		" FOR (n:" + label + ") REQUIRE n." + property + " IS UNIQUE"
+}
+
+// index is the statement indexing the nodes of label on properties, in the form Neo4j 4.4 and 5 share
+func index(label string, properties ...string) string {
+	keys := make([]string, len(properties))
+	for position, property := range properties {
+		keys[position] = "n." + property
+	}
+	return "CREATE INDEX " + strings.ToLower(label) + "_" + strings.Join(properties, "_") + " IF NOT EXISTS" +
+		" FOR (n:" + label + ") ON (" + strings.Join(keys, ", ") + ")"
+}
@@ -0,0 +1,41 @@
+package database
+
+import "testing"
+
+func TestUniqueConstraint(t *testing.T) {
+	tests := []struct {
+		label    string
+		property string
+		want     string
+	}{
+		{"User", "uuid", "CREATE CONSTRAINT user_uuid_unique IF NOT EXISTS FOR (n:User) REQUIRE n.uuid IS UNIQUE"},
+		{"IdempotencyKey", "id", "CREATE CONSTRAINT idempotencykey_id_unique IF NOT EXISTS FOR (n:IdempotencyKey) REQUIRE n.id IS UNIQUE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			if got := uniqueConstraint(tt.label, tt.property); got != tt.want {
+				t.Errorf("uniqueConstraint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndex(t *testing.T) {
+	tests := []struct {
+		label      string
+		properties []string
+		want       string
+	}{
+		{"NodeVersion", []string{"nodeLabel", "nodeKey"}, "CREATE INDEX nodeversion_nodeLabel_nodeKey IF NOT EXISTS FOR (n:NodeVersion) ON (n.nodeLabel, n.nodeKey)"},
+		{"IdempotencyKey", []string{"expiresAt"}, "CREATE INDEX idempotencykey_expiresAt IF NOT EXISTS FOR (n:IdempotencyKey) ON (n.expiresAt)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			if got := index(tt.label, tt.properties...); got != tt.want {
+				t.Errorf("index() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
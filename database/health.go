@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// CheckHealth verifies the driver can reach the database and run a trivial read within timeout,
+// returning how long the check took
+func CheckHealth(ctx context.Context, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+
+	if Driver == nil {
+		return 0, fmt.Errorf("database driver has not been created")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// VerifyConnectivity has no timeout of its own so run the check on a thread
+	done := make(chan error, 1)
+	go func() {
+		if err := Driver.VerifyConnectivity(); err != nil {
+			done <- err
+			return
+		}
+		done <- trivialRead(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return time.Since(start), err
+	case <-ctx.Done():
+		return time.Since(start), fmt.Errorf("database health check: %w", ctx.Err())
+	}
+}
+
+// Private functions
+
+// trivialRead runs RETURN 1 on a session of its own rather than through runTransaction, so the probe
+// is neither retried nor refused by the breaker and its failures don't open the breaker for real traffic
+func trivialRead(ctx context.Context) error {
+	timeout, err := transactionTimeout(ctx)
+	if err != nil {
+		return err
+	}
+
+	session := Driver.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead, DatabaseName: databaseName})
+	defer session.Close()
+
+	_, err = session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		transactionResult, driverNativeErr := transaction.Run("RETURN 1", nil)
+
+		// Raw driver error
+		if driverNativeErr != nil {
+			return nil, driverNativeErr
+		}
+
+		return transactionResult.Single()
+	}, neo4j.WithTxTimeout(timeout))
+
+	return err
+}
@@ -0,0 +1,218 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// VersionProperty counts the writes to a node, it is raised under the node's write lock so versions never clash
+const VersionProperty = "_version"
+
+// versionLabel is the label of the snapshots kept of every write
+const versionLabel = "NodeVersion"
+
+// bumpVersion is the Cypher SET item raising the version of n
+const bumpVersion = "n." + VersionProperty + " = coalesce(n." + VersionProperty + ", 0) + 1"
+
+// Version is the state of a node after one write, Deleted marks the snapshot taken when it was removed
+type Version struct {
+	Version    int64
+	RecordedAt time.Time
+	Deleted    bool
+	Properties map[string]string
+}
+
+// recordVersion appends a snapshot of node to its history in the transaction that wrote it
+func recordVersion(ctx context.Context, transaction neo4j.Transaction, label, key string, node neo4j.Node, deleted bool) error {
+	state := make(map[string]interface{}, len(node.Props))
+	for property, value := range node.Props {
+		if property != VersionProperty {
+			state[property] = value
+		}
+	}
+
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	version, _ := node.Props[VersionProperty].(int64)
+	if deleted {
+		version++
+	}
+
+	result, err := transaction.Run("CREATE (v:"+versionLabel+" {nodeLabel: $label, nodeKey: $key, institution: $institution,"+
+		" version: $version, recordedAt: datetime(), deleted: $deleted, state: $state})", map[string]interface{}{
+		"label":       label,
+		"key":         propertyString(node.Props[key]),
+		"institution": node.Props[InstitutionProperty],
+		"version":     version,
+		"deleted":     deleted,
+		"state":       string(encoded),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = result.Consume()
+	if err != nil {
+		return err
+	}
+
+	return ctx.Err()
+}
+
+// writeVersioned runs a write returning the written node in the column n and snapshots every node it returns
+func writeVersioned(ctx context.Context, function, label, key, cypher string, queryData map[string]interface{}) ([]*neo4j.Record, error) {
+	result, err := runTransaction(ctx, function, neo4j.AccessModeWrite, cypher, queryData,
+		func(transaction neo4j.Transaction) (interface{}, error) {
+
+			// Don't start work for a caller that has gone away
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			writeResult, err := transaction.Run(cypher, queryData)
+			if err != nil {
+				return nil, err
+			}
+			records, err := writeResult.Collect()
+			if err != nil {
+				return nil, err
+			}
+
+			for _, record := range records {
+				node, _ := record.Get("n")
+				if err := recordVersion(ctx, transaction, label, key, node.(neo4j.Node), false); err != nil {
+					return nil, err
+				}
+			}
+
+			return records, nil
+		})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.([]*neo4j.Record), nil
+}
+
+// writeVersioned runs a versioned write of this label returning n and converts the nodes
+func (r *Repository) writeVersioned(ctx context.Context, function, cypher string, queryData map[string]interface{}) ([]map[string]string, error) {
+	records, err := writeVersioned(ctx, function, r.label.Name, r.label.Key, cypher, queryData)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]map[string]string, len(records))
+	for index, record := range records {
+		nodes[index] = nodeProperties(record.Values[0].(neo4j.Node))
+	}
+	return nodes, nil
+}
+
+// History returns every recorded version of the node with key, oldest first
+func (r *Repository) History(ctx context.Context, key string) ([]Version, error) {
+	return r.versions(ctx, key, nil, 0)
+}
+
+// AsOf returns the node with key as it was at a moment, ErrNotFound when it didn't exist then
+func (r *Repository) AsOf(ctx context.Context, key string, at time.Time) (map[string]string, error) {
+	versions, err := r.versions(ctx, key, &at, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(versions) == 0 || versions[len(versions)-1].Deleted {
+		return nil, ErrNotFound
+	}
+
+	return versions[len(versions)-1].Properties, nil
+}
+
+// Revert writes the properties the node with key had at version back to it, recording a new version.
+// Properties the node didn't have then are removed.
+func (r *Repository) Revert(ctx context.Context, key string, version int64) (map[string]string, error) {
+	versions, err := r.versions(ctx, key, nil, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(versions) == 0 {
+		return nil, invalid("%s %s has no version %d", r.label.Name, key, version)
+	}
+
+	// A node deleted and created again numbers its versions from one again, the latest is the one meant
+	target := versions[len(versions)-1]
+	if target.Deleted {
+		return nil, invalid("version %d of %s %s is its deletion", version, r.label.Name, key)
+	}
+
+	values := make(map[string]string, len(r.label.Properties))
+	for _, property := range r.label.Properties {
+		if property.Name != r.label.Key {
+			values[property.Name] = target.Properties[property.Name]
+		}
+	}
+	if institution, ok := target.Properties[InstitutionProperty]; ok {
+		values[InstitutionProperty] = institution
+	}
+
+	return r.Update(ctx, key, values)
+}
+
+// versions reads the snapshots of the node with key, only those recorded up to before when it is set
+// and only the one numbered version when that is above zero
+func (r *Repository) versions(ctx context.Context, key string, before *time.Time, version int64) ([]Version, error) {
+	scope, err := scopeFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	queryData := map[string]interface{}{"label": r.label.Name, "key": key, "before": timeParameter(before), "version": version}
+
+	conditions := []string{"($before IS NULL OR v.recordedAt <= $before)", "($version = 0 OR v.version = $version)"}
+	if condition := scope.condition("v", queryData); condition != "" {
+		conditions = append(conditions, condition)
+	}
+
+	query := "MATCH (v:" + versionLabel + " {nodeLabel: $label, nodeKey: $key})" +
+		" WHERE " + strings.Join(conditions, " AND ") +
+		" RETURN v.version, v.recordedAt, v.deleted, v.state" +
+		" ORDER BY v.recordedAt, v.version"
+
+	records, err := recordsFromDB(ctx, "versions", neo4j.AccessModeRead, query, queryData)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]Version, len(records))
+	for index, record := range records {
+		// Numbers are kept as written rather than rounded through float64
+		var state map[string]interface{}
+		decoder := json.NewDecoder(strings.NewReader(record.Values[3].(string)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&state); err != nil {
+			return nil, err
+		}
+
+		properties := make(map[string]string, len(state))
+		for property, value := range state {
+			properties[property] = propertyString(value)
+		}
+
+		versions[index] = Version{
+			Version:    record.Values[0].(int64),
+			RecordedAt: record.Values[1].(time.Time),
+			Deleted:    record.Values[2].(bool),
+			Properties: properties,
+		}
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// IdempotencyTTL is how long the response to a request with an idempotency key is kept for its retries
+var IdempotencyTTL = 24 * time.Hour
+
+// idempotencyLabel is the label of the stored responses
+const idempotencyLabel = "IdempotencyKey"
+
+// maxExpiredKeys bounds the expired responses each new key clears away
+const maxExpiredKeys = 100
+
+// ErrRequestInProgress is returned when another request with the same idempotency key is being written,
+// the client should retry once it has finished
+var ErrRequestInProgress = errors.New("a request with this idempotency key is in progress")
+
+// constraintViolation is the code of a write refused by a uniqueness constraint
+const constraintViolation = "Neo.ClientError.Schema.ConstraintValidationFailed"
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey stores the idempotency key a client sent with a request
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// IdempotencyKey returns the key stored by WithIdempotencyKey, empty when the client sent none
+func IdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	return key
+}
+
+// Idempotent runs write once per key within IdempotencyTTL. write fills in response, which is stored as JSON
+// in the same transaction as its writes, and a retry with the same key decodes the stored response into
+// response instead of writing again. A write that failed leaves nothing behind so it may be retried.
+// request identifies what was asked for, reusing a key for a different request is refused.
+// Keys are per institution. The uniqueness constraint on IdempotencyKey.id from EnsureConstraints makes a
+// concurrent attempt wait for the first, or fail with ErrRequestInProgress, rather than write again.
+func Idempotent(ctx context.Context, key string, request, response interface{}, write func(ctx context.Context) error) error {
+	scope, err := scopeFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	requestFingerprint, err := fingerprint(request)
+	if err != nil {
+		return err
+	}
+
+	queryData := map[string]interface{}{
+		"id":          scope.Institution + "/" + key,
+		"fingerprint": requestFingerprint,
+		"ttl":         IdempotencyTTL.Milliseconds(),
+		"limit":       maxExpiredKeys,
+	}
+
+	return InTransaction(ctx, func(ctx context.Context) error {
+		claimedFingerprint, stored, err := claimIdempotencyKey(ctx, queryData)
+		var neo4jErr *neo4j.Neo4jError
+		if errors.As(err, &neo4jErr) && neo4jErr.Code == constraintViolation {
+			return ErrRequestInProgress
+		}
+		if err != nil {
+			return err
+		}
+
+		if claimedFingerprint != queryData["fingerprint"] {
+			return invalid("the idempotency key was already used for a different request")
+		}
+
+		// Only a committed write leaves a response, so this is a retry of one that succeeded
+		if stored != nil {
+			return json.Unmarshal([]byte(stored.(string)), response)
+		}
+
+		if err := write(ctx); err != nil {
+			return err
+		}
+
+		encodedResponse, err := json.Marshal(response)
+		if err != nil {
+			return err
+		}
+
+		queryData["response"] = string(encodedResponse)
+		_, err = recordsFromDB(ctx, "storeIdempotentResponse", neo4j.AccessModeWrite,
+			"MATCH (k:"+idempotencyLabel+" {id: $id}) SET k.response = $response", queryData)
+		return err
+	})
+}
+
+// fingerprint identifies a request by the SHA-256 of its JSON, which lists map keys in order so equal requests match
+func fingerprint(request interface{}) (string, error) {
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(encoded)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// claimIdempotencyKey clears away the requested key if it has expired and a batch of other expired keys, found
+// through the index on expiresAt, then finds or creates the requested key returning the fingerprint of the
+// request that created it and its response, nil while there is none
+func claimIdempotencyKey(ctx context.Context, queryData map[string]interface{}) (string, interface{}, error) {
+	_, err := recordsFromDB(ctx, "expireIdempotencyKey", neo4j.AccessModeWrite,
+		"MATCH (k:"+idempotencyLabel+" {id: $id}) WHERE k.expiresAt <= datetime() DELETE k", queryData)
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = recordsFromDB(ctx, "expireIdempotencyKeys", neo4j.AccessModeWrite,
+		"MATCH (k:"+idempotencyLabel+") WHERE k.expiresAt <= datetime() WITH k LIMIT $limit DELETE k", queryData)
+	if err != nil {
+		return "", nil, err
+	}
+
+	records, err := recordsFromDB(ctx, "claimIdempotencyKey", neo4j.AccessModeWrite,
+		"MERGE (k:"+idempotencyLabel+" {id: $id})"+
+			" ON CREATE SET k.fingerprint = $fingerprint, k.expiresAt = datetime() + duration({milliseconds: $ttl})"+
+			" RETURN k.fingerprint, k.response", queryData)
+	if err != nil {
+		return "", nil, err
+	}
+
+	fingerprint, _ := records[0].Values[0].(string)
+	return fingerprint, records[0].Values[1], nil
+}
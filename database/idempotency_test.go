@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+type upsertRequest struct {
+	ID   *string
+	Name string
+}
+
+func TestFingerprint(t *testing.T) {
+	id := "a2f1"
+
+	tests := []struct {
+		name string
+		a, b interface{}
+		same bool
+	}{
+		{"equal structs", upsertRequest{Name: "Ada"}, upsertRequest{Name: "Ada"}, true},
+		{"different field", upsertRequest{Name: "Ada"}, upsertRequest{Name: "Alan"}, false},
+		{"pointer set", upsertRequest{Name: "Ada"}, upsertRequest{ID: &id, Name: "Ada"}, false},
+		{"maps in any order", map[string]int{"a": 1, "b": 2}, map[string]int{"b": 2, "a": 1}, true},
+		{"lists in another order", []string{"a", "b"}, []string{"b", "a"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := fingerprint(tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := fingerprint(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (a == b) != tt.same {
+				t.Errorf("fingerprints %s and %s, want same = %v", a, b, tt.same)
+			}
+			if len(a) != 64 {
+				t.Errorf("fingerprint length = %d, want 64", len(a))
+			}
+		})
+	}
+}
+
+func TestFingerprintUnencodable(t *testing.T) {
+	if _, err := fingerprint(make(chan int)); err == nil {
+		t.Error("fingerprint() of a channel did not fail")
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	if key := IdempotencyKey(context.Background()); key != "" {
+		t.Errorf("IdempotencyKey() without one = %q", key)
+	}
+	if key := IdempotencyKey(WithIdempotencyKey(context.Background(), "retry-1")); key != "retry-1" {
+		t.Errorf("IdempotencyKey() = %q, want retry-1", key)
+	}
+}
@@ -0,0 +1,271 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Caps on the graph queries so a well connected node can't turn one request into a scan of the database
+const (
+	MaxPeerSuggestions    = 50
+	MaxNeighbourhoodDepth = 3
+	MaxNeighbourhoodNodes = 250
+	// maxNeighbourhoodHopEdges bounds the relationships read at each hop of a neighbourhood
+	maxNeighbourhoodHopEdges = 2000
+)
+
+// PeerQuery selects the peers suggested for a node
+type PeerQuery struct {
+	// Types are the relationships neighbours are found through, empty uses every type
+	Types []string
+	// SameProperty only suggests nodes with the same value for it, empty suggests any node of the label
+	SameProperty string
+	Limit        int
+}
+
+// Suggestion is a suggested peer, Score is the Jaccard similarity of the two nodes' neighbours
+type Suggestion struct {
+	Node   map[string]string
+	Common int64
+	Score  float64
+}
+
+// NeighbourhoodQuery selects the subgraph around a node
+type NeighbourhoodQuery struct {
+	Depth int
+	// Types limits the relationships followed, empty follows every type
+	Types []string
+	// AsOf only follows relationships valid at that moment, nil follows them all
+	AsOf *time.Time
+}
+
+// Subgraph is a set of nodes and the edges between them, Truncated is set when a cap cut it short
+type Subgraph struct {
+	Nodes     []map[string]string
+	Edges     []EdgeRecord
+	Truncated bool
+}
+
+// SuggestPeers recommends nodes of this label that share currently valid neighbours with the node with key,
+// best first, leaving out nodes it is already related to
+func (r *Repository) SuggestPeers(ctx context.Context, key string, peerQuery PeerQuery) ([]Suggestion, error) {
+	scope, err := scopeFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkTypes(peerQuery.Types); err != nil {
+		return nil, err
+	}
+
+	if peerQuery.SameProperty != "" {
+		if _, ok := r.label.property(peerQuery.SameProperty); !ok {
+			return nil, fmt.Errorf("%s has no property %s", r.label.Name, peerQuery.SameProperty)
+		}
+	}
+
+	limit := peerQuery.Limit
+	if limit <= 0 || limit > MaxPeerSuggestions {
+		limit = MaxPeerSuggestions
+	}
+
+	queryData := map[string]interface{}{"key": r.keyValue(key), "asOf": time.Now(), "types": typesParameter(peerQuery.Types), "limit": limit}
+
+	// followed is the predicate for a relationship neighbours are found through
+	followed := func(alias string) string {
+		return "(size($types) = 0 OR type(" + alias + ") IN $types) AND " + validAt(alias)
+	}
+
+	// scoped limits every alias to the caller's institution
+	scoped := func(aliases ...string) string {
+		if scope.AllInstitutions {
+			return ""
+		}
+		conditions := make([]string, len(aliases))
+		for index, alias := range aliases {
+			conditions[index] = " AND " + scope.condition(alias, queryData)
+		}
+		return strings.Join(conditions, "")
+	}
+
+	samePeer := ""
+	if peerQuery.SameProperty != "" {
+		samePeer = " AND peer." + peerQuery.SameProperty + " = u." + peerQuery.SameProperty
+	}
+
+	var query strings.Builder
+	query.WriteString("MATCH (u:" + r.label.Name + " {" + r.label.Key + ": $key})")
+	query.WriteString(" WHERE true" + scoped("u"))
+	query.WriteString(" OPTIONAL MATCH (u)-[x]-(n) WHERE " + followed("x") + scoped("n"))
+	query.WriteString(" WITH u, collect(DISTINCT n) AS mine")
+	query.WriteString(" MATCH (u)-[r1]-(shared)-[r2]-(peer:" + r.label.Name + ")")
+	query.WriteString(" WHERE peer <> u AND shared IN mine AND " + followed("r1") + " AND " + followed("r2") + samePeer + scoped("peer"))
+	query.WriteString(" AND NOT (u)--(peer)")
+	query.WriteString(" WITH u, mine, peer, count(DISTINCT shared) AS common")
+	query.WriteString(" OPTIONAL MATCH (peer)-[y]-(m) WHERE " + followed("y") + scoped("m"))
+	query.WriteString(" WITH peer, common, size(mine) AS mineCount, count(DISTINCT m) AS theirCount")
+	query.WriteString(" RETURN peer, common, toFloat(common) / (mineCount + theirCount - common) AS score")
+	query.WriteString(" ORDER BY score DESC, common DESC, peer." + r.label.Key)
+	query.WriteString(" LIMIT $limit")
+
+	records, err := recordsFromDB(ctx, "suggestPeers", neo4j.AccessModeRead, query.String(), queryData)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]Suggestion, len(records))
+	for index, record := range records {
+		suggestions[index] = Suggestion{
+			Node:   nodeProperties(record.Values[0].(neo4j.Node)),
+			Common: record.Values[1].(int64),
+			Score:  record.Values[2].(float64),
+		}
+	}
+	return suggestions, nil
+}
+
+// Neighbourhood returns the nodes within Depth relationships of the node with key and the edges on the way,
+// capped at MaxNeighbourhoodNodes. It expands one hop at a time from the nodes the last hop found, reading at most
+// maxNeighbourhoodHopEdges relationships a hop, so a well connected node can't make it enumerate every path.
+func (r *Repository) Neighbourhood(ctx context.Context, key string, neighbourhoodQuery NeighbourhoodQuery) (*Subgraph, error) {
+	scope, err := scopeFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkTypes(neighbourhoodQuery.Types); err != nil {
+		return nil, err
+	}
+
+	if neighbourhoodQuery.Depth < 1 || neighbourhoodQuery.Depth > MaxNeighbourhoodDepth {
+		return nil, invalid("depth must be between 1 and %d", MaxNeighbourhoodDepth)
+	}
+
+	queryData := map[string]interface{}{
+		"key":   r.keyValue(key),
+		"asOf":  timeParameter(neighbourhoodQuery.AsOf),
+		"types": typesParameter(neighbourhoodQuery.Types),
+		"limit": maxNeighbourhoodHopEdges,
+	}
+
+	rootQuery := "MATCH (u:" + r.label.Name + " {" + r.label.Key + ": $key})" + scopeWhere(scope, queryData, "u") + " RETURN u"
+
+	hopConditions := []string{"id(n) IN $frontier", "(size($types) = 0 OR type(e) IN $types)", validAt("e")}
+	if condition := scope.condition("m", queryData); condition != "" {
+		hopConditions = append(hopConditions, condition)
+	}
+	hopQuery := "MATCH (n)-[e]-(m) WHERE " + strings.Join(hopConditions, " AND ") + " RETURN e, m LIMIT $limit"
+
+	result, err := runTransaction(ctx, "neighbourhood", neo4j.AccessModeRead, rootQuery+"; "+hopQuery, queryData,
+		func(transaction neo4j.Transaction) (interface{}, error) {
+
+			// Don't start work for a caller that has gone away
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			rootResult, err := transaction.Run(rootQuery, queryData)
+			if err != nil {
+				return nil, err
+			}
+			if !rootResult.Next() {
+				if err := rootResult.Err(); err != nil {
+					return nil, err
+				}
+				return nil, ErrNotFound
+			}
+
+			subgraph := &Subgraph{}
+			nodes := make(map[int64]neo4j.Node)
+			edges := make(map[int64]bool)
+
+			// addNode keeps the node if it is new and there is room, reporting whether it did
+			addNode := func(node neo4j.Node) bool {
+				if _, ok := nodes[node.Id]; ok {
+					return false
+				}
+				if len(nodes) >= MaxNeighbourhoodNodes {
+					subgraph.Truncated = true
+					return false
+				}
+				nodes[node.Id] = node
+				subgraph.Nodes = append(subgraph.Nodes, nodeProperties(node))
+				return true
+			}
+
+			root := rootResult.Record().Values[0].(neo4j.Node)
+			addNode(root)
+
+			// Hops go outwards so the nodes closest to the root are kept when the cap is reached
+			frontier := []int64{root.Id}
+			for hop := 0; hop < neighbourhoodQuery.Depth && len(frontier) > 0; hop++ {
+				queryData["frontier"] = frontier
+
+				hopResult, err := transaction.Run(hopQuery, queryData)
+				if err != nil {
+					return nil, err
+				}
+
+				var next []int64
+				read := 0
+				for hopResult.Next() {
+					if err := ctx.Err(); err != nil {
+						return nil, err
+					}
+					read++
+
+					values := hopResult.Record().Values
+					if other := values[1].(neo4j.Node); addNode(other) {
+						next = append(next, other.Id)
+					}
+
+					relationship := values[0].(neo4j.Relationship)
+					from, fromKept := nodes[relationship.StartId]
+					to, toKept := nodes[relationship.EndId]
+					if edges[relationship.Id] || !fromKept || !toKept {
+						continue
+					}
+					edges[relationship.Id] = true
+					subgraph.Edges = append(subgraph.Edges, *edgeFromParts(from, relationship, to))
+				}
+				if err := hopResult.Err(); err != nil {
+					return nil, err
+				}
+
+				if read >= maxNeighbourhoodHopEdges {
+					subgraph.Truncated = true
+				}
+				frontier = next
+			}
+
+			return subgraph, nil
+		})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*Subgraph), nil
+}
+
+// checkTypes rejects relationship type names that can't be in the catalogue
+func checkTypes(types []string) error {
+	for _, edgeType := range types {
+		if !relationshipTypePattern.MatchString(edgeType) {
+			return invalid("invalid relationship type %q", edgeType)
+		}
+	}
+	return nil
+}
+
+// typesParameter passes a list of relationship types to a query, an empty list rather than null when there are none
+func typesParameter(types []string) []string {
+	if types == nil {
+		return []string{}
+	}
+	return types
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		types   []string
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"upper snake case", []string{"TUTORS", "PERSONAL_TUTOR", "MEMBER_OF_2"}, false},
+		{"lower case", []string{"tutors"}, true},
+		{"leading digit", []string{"2TUTORS"}, true},
+		{"injection", []string{"TUTORS]-() DETACH DELETE (n"}, true},
+		{"one bad among good", []string{"TUTORS", "Tutors"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTypes(tt.types)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkTypes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var validationErr *ValidationError
+			if err != nil && !errors.As(err, &validationErr) {
+				t.Errorf("checkTypes() error = %v, want a ValidationError", err)
+			}
+		})
+	}
+}
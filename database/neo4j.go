@@ -1,246 +1,120 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
-	"log"
-	"strconv"
-	"strings"
+	"github.com/sirupsen/logrus"
 )
 
 var Driver neo4j.Driver
 
-type SearchNode struct {
-	NodeName    string
-	SearchKey   string
-	SearchValue string
-}
-
-type MultiParamSearchNode struct {
-	NodeName     string
-	SearchParams map[string]string
-	SearchLimit  int64
-	Ordering     []string
-	Descending   bool
-}
-
 // Public functions
 
 // CreateDriver call once at start of application
-func CreateDriver(uri, username, password string) error {
-	var err error
-	Driver, err = neo4j.NewDriver(uri, neo4j.BasicAuth(username, password, ""))
+func CreateDriver(uri, username, password string, settings DriverSettings) error {
+	target, err := settings.targetUri(uri)
+	if err != nil {
+		return err
+	}
+
+	rootCAs, err := settings.rootCAs()
+	if err != nil {
+		return err
+	}
+
+	Driver, err = neo4j.NewDriver(target, neo4j.BasicAuth(username, password, ""), func(config *neo4j.Config) {
+		if settings.MaxConnectionPoolSize > 0 {
+			config.MaxConnectionPoolSize = settings.MaxConnectionPoolSize
+		}
+		if settings.ConnectionAcquisitionTimeout > 0 {
+			config.ConnectionAcquisitionTimeout = settings.ConnectionAcquisitionTimeout
+		}
+		if settings.MaxConnectionLifetime > 0 {
+			config.MaxConnectionLifetime = settings.MaxConnectionLifetime
+		}
+		if rootCAs != nil {
+			config.RootCAs = rootCAs
+		}
+	})
 
 	// Local driver error
 	if err != nil {
 		return err
 	}
 
+	databaseName = settings.DatabaseName
+
 	// Verify Connectivity
 	err = Driver.VerifyConnectivity()
 	return err
 }
 
-// CloseDriver call on application exit
-func CloseDriver() error {
-	log.Printf("Closing DB")
-	return Driver.Close()
-}
-
-// UpdateInsertQuery Insert or Update a node into the database
-func UpdateInsertQuery(node SearchNode, insertionData map[string]string) (map[string]string, error) {
-
-	var queryParameters = ""
-	var queryReturnParameters = ""
-	var queryData = make(map[string]interface{})
-
-	for property, value := range insertionData {
-		queryParameters += " n." + property + " = $" + property + ","
-		queryReturnParameters += " n." + property + " AS " + property + ","
-		queryData[property] = value
+// CloseDriver call on application exit once the HTTP server has stopped, it waits for running
+// transactions to finish until ctx is done and then closes the driver regardless.
+// Transactions started after it is called fail with ErrUnavailable.
+func CloseDriver(ctx context.Context) error {
+	if Driver == nil {
+		return nil
 	}
 
-	queryParameters = strings.Trim(queryParameters, ",")
-	queryReturnParameters = strings.Trim(queryReturnParameters, ",")
-
-	var query strings.Builder
-	query.WriteString("MERGE (n:")
-	query.WriteString(node.NodeName)
-	query.WriteString("{" + node.SearchKey + ": $" + node.SearchKey + "})")
-	query.WriteString(" ON CREATE SET")
-	query.WriteString(queryParameters)
-	query.WriteString(" ON MATCH SET")
-	query.WriteString(queryParameters)
-	query.WriteString(" RETURN")
-	query.WriteString(queryReturnParameters)
-
-	neo4jWriteResult, neo4jWriteErr := writeSingleNodeToDB(query.String(), queryData)
-
-	//  write failed
-	if neo4jWriteErr != nil {
-		return nil, neo4jWriteErr
+	closingMu.Lock()
+	if !closing {
+		closing = true
+		drained = make(chan struct{})
+		if inFlight == 0 {
+			close(drained)
+		}
 	}
+	closingMu.Unlock()
 
-	// write success
-	if neo4jWriteResult != nil {
-		return neo4jWriteResult.(map[string]string), nil
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		logrus.Warn("Closing DB with transactions still running")
 	}
 
-	return nil, fmt.Errorf("single node write operation did not return a result")
+	logrus.Info("Closing DB")
+	return Driver.Close()
 }
 
-// SimpleQuery Find a node in the database on a single property
-func SimpleQuery(node SearchNode, propertyData []string) (map[string]string, error) {
-
-	queryReturnParameters := ""
-	for _, property := range propertyData {
-		queryReturnParameters += " n." + property + " AS " + property + ","
-	}
-	queryReturnParameters = strings.Trim(queryReturnParameters, ",")
-	//queryReturnParameters += " n"
-
-	var queryData = make(map[string]interface{})
-	queryData[node.SearchKey] = node.SearchValue
-
-	var query strings.Builder
-	query.WriteString("MATCH (n:")
-	query.WriteString(node.NodeName)
-	query.WriteString("{" + node.SearchKey + ": $" + node.SearchKey + "})")
-	query.WriteString(" RETURN")
-	query.WriteString(queryReturnParameters)
-
-	neo4jReadResult, neo4jReadErr := readSingleNodeFromDB(query.String(), queryData)
-
-	//  read failed
-	if neo4jReadErr != nil {
-		return nil, fmt.Errorf("single node search did not find node %s with a property %s containing the value %s", node.NodeName, node.SearchKey, node.SearchValue)
-		//return nil, neo4jReadErr
-	}
+// Private functions
 
-	// read found a result
-	if neo4jReadResult != nil {
-		return neo4jReadResult.(map[string]string), nil
+// propertyString converts a returned property to a string, a property the node doesn't have is empty
+func propertyString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprintf("%v", v)
 	}
-
-	// Catch all statement shouldn't execute but as a safety net.  Would require nil, nil readSingleNodeFromDB return
-	return nil, fmt.Errorf("single node search returned an nil record set with nil error for node %s with a property %s containing the value %s",
-		node.NodeName, node.SearchKey, node.SearchValue)
 }
 
-// NodeQuery Query that returns multiple nodes
-func NodeQuery(node MultiParamSearchNode) (*[]map[string]string, error) {
-
-	querySearchProperties := ""
-
-	var queryData = make(map[string]interface{})
-
-	for propertyName, propertyVal := range node.SearchParams {
-		querySearchProperties += " n." + propertyName + " = $" + propertyName + ","
-		queryData[propertyName] = propertyVal
-	}
-
-	querySearchProperties = " WHERE" + strings.Trim(querySearchProperties, ",")
-
-	queryReturnParameters := " n"
-
-	queryOrdering := ""
-
-	for _, propertyVal := range node.Ordering {
-		queryOrdering += "n." + propertyVal + ", "
-	}
-
-	if len(queryOrdering) > 0 {
-		queryOrdering = " ORDER BY " + strings.Trim(queryOrdering, ",")
-		if node.Descending {
-			queryOrdering += queryOrdering + " DESC"
-		}
-	}
-
-	var query strings.Builder
-	query.WriteString("MATCH (n:")
-	query.WriteString(node.NodeName)
-	query.WriteString(")" + querySearchProperties + "")
-	query.WriteString(" RETURN")
-	query.WriteString(queryReturnParameters)
-	query.WriteString(queryOrdering)
-	if node.SearchLimit > 0 {
-		query.WriteString(" LIMIT " + strconv.FormatInt(node.SearchLimit, 10))
-	}
-
-	neo4jReadResultPtr, neo4jReadErr := readNodesFromDB(query.String(), queryData)
-
-	//  read failed
-	if neo4jReadErr != nil {
-		return nil, fmt.Errorf("node search did not find any nodes %s", node.NodeName)
-		//return nil, neo4jReadErr
+// nodeProperties converts the properties of a returned node to strings
+func nodeProperties(node neo4j.Node) map[string]string {
+	properties := make(map[string]string, len(node.Props))
+	for key, val := range node.Props {
+		properties[key] = propertyString(val)
 	}
+	return properties
+}
 
-	// read found a result
-	if neo4jReadResultPtr != nil {
-
-		return neo4jReadResultPtr, nil
-	}
-
-	// Catch all statement shouldn't execute but as a safety net.  Would require nil, nil readSingleNodeFromDB return
-	return nil, fmt.Errorf("node search returned an empty record set with no errors")
-
+func readNodesFromDB(ctx context.Context, cypher string, params map[string]interface{}) (*[]map[string]string, error) {
+	return nodesFromDB(ctx, "readNodesFromDB", neo4j.AccessModeRead, cypher, params)
 }
 
-// Private functions
-func writeSingleNodeToDB(cypher string, params map[string]interface{}) (interface{}, error) {
-
-	// Open session
-	session := Driver.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
-	defer func(session neo4j.Session) {
-		err := session.Close()
-		if err != nil {
-			log.Println(err)
-		}
-	}(session)
+// recordsFromDB runs cypher and returns every record it produced
+func recordsFromDB(ctx context.Context, function string, accessMode neo4j.AccessMode, cypher string, params map[string]interface{}) ([]*neo4j.Record, error) {
 
-	// Start write data to neo4j
-	neo4jWriteResult, neo4jWriteErr := session.WriteTransaction(
+	neo4jReadResult, neo4jReadErr := runTransaction(ctx, function, accessMode, cypher, params,
 		func(transaction neo4j.Transaction) (interface{}, error) {
 
-			transactionResult, driverNativeErr :=
-				transaction.Run(cypher, params)
-
-			// Raw driver error
-			if driverNativeErr != nil {
-				return nil, driverNativeErr
+			// Don't start work for a caller that has gone away
+			if err := ctx.Err(); err != nil {
+				return nil, err
 			}
-			nodeProperties := make(map[string]string)
-			// If result returned
-			if transactionResult.Next() {
-
-				for index, property := range transactionResult.Record().Keys {
-					nodeProperties[property] = transactionResult.Record().Values[index].(string)
-				}
-				// Return the created nodes data
-				return nodeProperties, nil
-
-			}
-
-			// Node wasn't created there was an error return this
-			return nodeProperties, transactionResult.Err()
-		})
-
-	return neo4jWriteResult, neo4jWriteErr
-
-}
-func readSingleNodeFromDB(cypher string, params map[string]interface{}) (interface{}, error) {
-
-	// Open session
-	session := Driver.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
-	defer func(session neo4j.Session) {
-		err := session.Close()
-		if err != nil {
-			log.Println(err)
-		}
-	}(session)
-
-	neo4jReadResult, neo4jReadErr := session.ReadTransaction(
-		func(transaction neo4j.Transaction) (interface{}, error) {
 
 			transactionResult, driverNativeErr :=
 				transaction.Run(cypher, params)
@@ -250,64 +124,41 @@ func readSingleNodeFromDB(cypher string, params map[string]interface{}) (interfa
 				return nil, driverNativeErr
 			}
 
-			nodeProperties := make(map[string]string)
-
-			record, err := transactionResult.Single()
-
-			if err != nil {
-				return nil, transactionResult.Err()
+			// Collect the records stopping early if the caller cancels
+			var records []*neo4j.Record
+			for transactionResult.Next() {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				records = append(records, transactionResult.Record())
 			}
 
-			// If result returned
-			for index, property := range record.Keys {
-				nodeProperties[property] = record.Values[index].(string)
-			}
 			// Return the created nodes data
-			return nodeProperties, nil
-
+			return records, transactionResult.Err()
 		})
 
-	return neo4jReadResult, neo4jReadErr
+	if neo4jReadErr != nil {
+		return nil, neo4jReadErr
+	}
 
+	return neo4jReadResult.([]*neo4j.Record), nil
 }
-func readNodesFromDB(cypher string, params map[string]interface{}) (*[]map[string]string, error) {
-	// Open session
-	session := Driver.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
-	defer func(session neo4j.Session) {
-		err := session.Close()
-		if err != nil {
-			log.Println(err)
-		}
-	}(session)
 
-	neo4jReadResult, neo4jReadErr := session.ReadTransaction(
-		func(transaction neo4j.Transaction) (interface{}, error) {
+// nodesFromDB runs cypher and converts the node in the first column of every record to its properties
+func nodesFromDB(ctx context.Context, function string, accessMode neo4j.AccessMode, cypher string, params map[string]interface{}) (*[]map[string]string, error) {
 
-			transactionResult, driverNativeErr :=
-				transaction.Run(cypher, params)
+	records, neo4jReadErr := recordsFromDB(ctx, function, accessMode, cypher, params)
 
-			// Raw driver error
-			if driverNativeErr != nil {
-				return nil, driverNativeErr
-			}
-
-			// Return the created nodes data
-			return transactionResult.Collect()
-		})
-
-	usersSlice := make([]map[string]string, len(neo4jReadResult.([]*neo4j.Record)))
-
-	for index, node := range neo4jReadResult.([]*neo4j.Record) {
-
-		nodeProps := make(map[string]string, len(node.Values[0].(neo4j.Node).Props))
-
-		for key, val := range node.Values[0].(neo4j.Node).Props {
-			nodeProps[key] = fmt.Sprintf("%v", val)
-		}
+	// Read failed, there are no records to convert
+	if neo4jReadErr != nil {
+		return nil, neo4jReadErr
+	}
 
-		usersSlice[index] = nodeProps
+	usersSlice := make([]map[string]string, len(records))
 
+	for index, node := range records {
+		usersSlice[index] = nodeProperties(node.Values[0].(neo4j.Node))
 	}
 
-	return &usersSlice, neo4jReadErr
+	return &usersSlice, nil
 }
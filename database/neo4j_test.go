@@ -0,0 +1,249 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// errStatementFailed is what fakeDriver returns for a failing statement, it isn't transient so it isn't retried
+var errStatementFailed = errors.New("statement failed")
+
+// fakeDriver stands in for Neo4j, it runs transaction work without a server and keeps the statements
+// of the transactions that committed. Methods the package doesn't call are left to the nil embedded Driver.
+type fakeDriver struct {
+	neo4j.Driver
+
+	// fail makes any statement containing it fail
+	fail string
+	// records, when set, gives the records a statement returns, otherwise there are none
+	records func(cypher string) []*neo4j.Record
+	// started, when set, is sent every statement as it starts
+	started chan string
+	// release, when set, holds every statement until it is closed
+	release chan struct{}
+
+	mu        sync.Mutex
+	sessions  int
+	committed []string
+	closed    bool
+}
+
+// withDriver makes driver the package's Driver for the test, reopening the package once it is done
+func withDriver(t *testing.T, driver *fakeDriver) {
+	previous := Driver
+	Driver = driver
+	t.Cleanup(func() {
+		// Closing waits for the test's transactions, then the package is reopened for the next test
+		_ = CloseDriver(context.Background())
+		Driver = previous
+		closingMu.Lock()
+		closing = false
+		closingMu.Unlock()
+	})
+}
+
+func (d *fakeDriver) NewSession(neo4j.SessionConfig) neo4j.Session {
+	d.mu.Lock()
+	d.sessions++
+	d.mu.Unlock()
+	return &fakeSession{driver: d}
+}
+
+func (d *fakeDriver) Close() error {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	return nil
+}
+
+// state returns the sessions opened, statements committed and whether the driver was closed so far
+func (d *fakeDriver) state() (int, []string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.sessions, append([]string(nil), d.committed...), d.closed
+}
+
+type fakeSession struct {
+	neo4j.Session
+	driver *fakeDriver
+}
+
+func (s *fakeSession) WriteTransaction(work neo4j.TransactionWork, _ ...func(*neo4j.TransactionConfig)) (interface{}, error) {
+	return s.run(work)
+}
+
+func (s *fakeSession) ReadTransaction(work neo4j.TransactionWork, _ ...func(*neo4j.TransactionConfig)) (interface{}, error) {
+	return s.run(work)
+}
+
+func (s *fakeSession) LastBookmark() string {
+	return ""
+}
+
+func (s *fakeSession) Close() error {
+	return nil
+}
+
+// run commits the statements of work when it succeeds and drops them, as a roll back would, when it fails
+func (s *fakeSession) run(work neo4j.TransactionWork) (interface{}, error) {
+	transaction := &fakeTransaction{driver: s.driver}
+	value, err := work(transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	s.driver.mu.Lock()
+	s.driver.committed = append(s.driver.committed, transaction.statements...)
+	s.driver.mu.Unlock()
+	return value, nil
+}
+
+type fakeTransaction struct {
+	neo4j.Transaction
+	driver     *fakeDriver
+	statements []string
+}
+
+func (t *fakeTransaction) Run(cypher string, _ map[string]interface{}) (neo4j.Result, error) {
+	if t.driver.started != nil {
+		t.driver.started <- cypher
+	}
+	if t.driver.release != nil {
+		<-t.driver.release
+	}
+
+	if t.driver.fail != "" && strings.Contains(cypher, t.driver.fail) {
+		return nil, errStatementFailed
+	}
+
+	t.statements = append(t.statements, cypher)
+
+	result := &fakeResult{}
+	if t.driver.records != nil {
+		result.records = t.driver.records(cypher)
+	}
+	return result, nil
+}
+
+// fakeResult returns records given up front
+type fakeResult struct {
+	neo4j.Result
+	records []*neo4j.Record
+	next    int
+}
+
+func (r *fakeResult) Next() bool {
+	if r.next >= len(r.records) {
+		return false
+	}
+	r.next++
+	return true
+}
+
+func (r *fakeResult) Record() *neo4j.Record {
+	return r.records[r.next-1]
+}
+
+func (r *fakeResult) Err() error {
+	return nil
+}
+
+func (r *fakeResult) Single() (*neo4j.Record, error) {
+	if len(r.records) != 1 {
+		return nil, fmt.Errorf("result has %d records, not one", len(r.records))
+	}
+	return r.records[0], nil
+}
+
+func (r *fakeResult) Consume() (neo4j.ResultSummary, error) {
+	r.next = len(r.records)
+	return nil, nil
+}
+
+func TestCloseDriver(t *testing.T) {
+	tests := []struct {
+		name string
+		// wait is how long CloseDriver may wait for the running transaction
+		wait        time.Duration
+		wantWaited  bool
+		wantRunning bool
+	}{
+		{"waits for running work", time.Minute, true, false},
+		{"gives up at the deadline", 20 * time.Millisecond, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := &fakeDriver{started: make(chan string, 1), release: make(chan struct{})}
+			withDriver(t, driver)
+
+			// A transaction that runs until released
+			finished := make(chan error, 1)
+			go func() {
+				_, err := recordsFromDB(context.Background(), "test", neo4j.AccessModeWrite, "CREATE (a)", nil)
+				finished <- err
+			}()
+			<-driver.started
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.wait)
+			defer cancel()
+			closed := make(chan error, 1)
+			go func() {
+				closed <- CloseDriver(ctx)
+			}()
+
+			select {
+			case <-closed:
+				if tt.wantWaited {
+					t.Fatal("CloseDriver() returned while a transaction was running")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if !tt.wantWaited {
+					t.Fatal("CloseDriver() waited past its deadline")
+				}
+			}
+
+			close(driver.release)
+			if err := <-finished; err != nil {
+				t.Errorf("running transaction error = %v, want it to finish", err)
+			}
+			if tt.wantWaited {
+				if err := <-closed; err != nil {
+					t.Fatalf("CloseDriver() error = %v", err)
+				}
+			}
+
+			_, committed, isClosed := driver.state()
+			if !isClosed {
+				t.Error("CloseDriver() didn't close the driver")
+			}
+			if len(committed) != 1 {
+				t.Errorf("committed = %v, want the running transaction", committed)
+			}
+		})
+	}
+}
+
+func TestCloseDriverRefusesNewTransactions(t *testing.T) {
+	driver := &fakeDriver{}
+	withDriver(t, driver)
+
+	if err := CloseDriver(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := recordsFromDB(context.Background(), "test", neo4j.AccessModeWrite, "CREATE (a)", nil)
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("transaction after close error = %v, want ErrUnavailable", err)
+	}
+	if sessions, _, _ := driver.state(); sessions != 0 {
+		t.Errorf("sessions = %d after close, want none", sessions)
+	}
+}
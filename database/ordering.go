@@ -0,0 +1,65 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Nulls says where nodes without a value for the sort property are placed
+type Nulls int
+
+const (
+	// NullsDefault leaves it to Neo4j, last when ascending and first when descending
+	NullsDefault Nulls = iota
+	NullsFirst
+	NullsLast
+)
+
+// SortField is one key of an ORDER BY, earlier fields take precedence
+type SortField struct {
+	Property   string
+	Descending bool
+	Nulls      Nulls
+}
+
+// propertyNamePattern is the property names that can be placed in a query without escaping
+var propertyNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// orderByClause builds the ORDER BY for variable from fields followed by the tieBreaker property, Cypher has no
+// NULLS FIRST/LAST so null placement is done by sorting on "IS NULL" ahead of the property itself
+func orderByClause(variable string, fields []SortField, tieBreaker string) (string, error) {
+	var keys []string
+	tieBroken := false
+
+	for _, field := range fields {
+		if !propertyNamePattern.MatchString(field.Property) {
+			return "", fmt.Errorf("cannot order by property %q", field.Property)
+		}
+
+		property := variable + "." + field.Property
+
+		switch field.Nulls {
+		case NullsFirst:
+			keys = append(keys, property+" IS NULL DESC")
+		case NullsLast:
+			keys = append(keys, property+" IS NULL")
+		}
+
+		if field.Descending {
+			keys = append(keys, property+" DESC")
+		} else {
+			keys = append(keys, property)
+		}
+
+		if field.Property == tieBreaker {
+			tieBroken = true
+		}
+	}
+
+	if !tieBroken {
+		keys = append(keys, variable+"."+tieBreaker)
+	}
+
+	return " ORDER BY " + strings.Join(keys, ", "), nil
+}
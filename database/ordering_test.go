@@ -0,0 +1,59 @@
+package database
+
+import "testing"
+
+func TestOrderByClause(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  []SortField
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "no fields sorts on the tiebreaker",
+			want: " ORDER BY n.uuid",
+		},
+		{
+			name:   "ascending and descending",
+			fields: []SortField{{Property: "name"}, {Property: "userType", Descending: true}},
+			want:   " ORDER BY n.name, n.userType DESC, n.uuid",
+		},
+		{
+			name:   "nulls first",
+			fields: []SortField{{Property: "name", Nulls: NullsFirst}},
+			want:   " ORDER BY n.name IS NULL DESC, n.name, n.uuid",
+		},
+		{
+			name:   "nulls last descending",
+			fields: []SortField{{Property: "name", Descending: true, Nulls: NullsLast}},
+			want:   " ORDER BY n.name IS NULL, n.name DESC, n.uuid",
+		},
+		{
+			name:   "tiebreaker is not repeated",
+			fields: []SortField{{Property: "uuid", Descending: true}},
+			want:   " ORDER BY n.uuid DESC",
+		},
+		{
+			name:    "property that could inject Cypher",
+			fields:  []SortField{{Property: "name DESC, n.password"}},
+			wantErr: true,
+		},
+		{
+			name:    "empty property",
+			fields:  []SortField{{}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := orderByClause("n", tt.fields, "uuid")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("orderByClause() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("orderByClause() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
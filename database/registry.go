@@ -0,0 +1,143 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// PropertyType is the Neo4j type a registered property is stored as
+type PropertyType string
+
+const (
+	PropertyString PropertyType = "string"
+	PropertyInt    PropertyType = "int"
+	PropertyFloat  PropertyType = "float"
+	PropertyBool   PropertyType = "bool"
+)
+
+// Property declares one property a label may carry
+type Property struct {
+	Name     string
+	Type     PropertyType
+	Required bool
+	// Default is written when a node is created without the property, empty for none
+	Default string
+	// Values limits a string property to a fixed set, empty allows anything
+	Values []string
+}
+
+// Label declares a node label, the property that identifies its nodes and the properties they may have.
+// The institution property is managed by the tenant scope and is always allowed.
+type Label struct {
+	Name       string
+	Key        string
+	Properties []Property
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Label)
+)
+
+// RegisterLabel adds label to the registry and returns a repository for its nodes
+func RegisterLabel(label Label) (*Repository, error) {
+	if err := label.check(); err != nil {
+		return nil, err
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[label.Name]; ok {
+		return nil, fmt.Errorf("label %s is already registered", label.Name)
+	}
+	registry[label.Name] = label
+
+	return &Repository{label: label}, nil
+}
+
+// MustRegisterLabel is RegisterLabel for package level declarations, it panics on an invalid label
+func MustRegisterLabel(label Label) *Repository {
+	repository, err := RegisterLabel(label)
+	if err != nil {
+		panic(err)
+	}
+	return repository
+}
+
+// check makes sure the names can be placed in a query and every property is usable
+func (l Label) check() error {
+	if !propertyNamePattern.MatchString(l.Name) {
+		return fmt.Errorf("invalid label name %q", l.Name)
+	}
+
+	if _, ok := l.property(l.Key); !ok {
+		return fmt.Errorf("label %s key %q is not one of its properties", l.Name, l.Key)
+	}
+
+	seen := make(map[string]bool)
+	for _, property := range l.Properties {
+		if !propertyNamePattern.MatchString(property.Name) || property.Name == InstitutionProperty {
+			return fmt.Errorf("label %s has an invalid property name %q", l.Name, property.Name)
+		}
+		if seen[property.Name] {
+			return fmt.Errorf("label %s declares property %s twice", l.Name, property.Name)
+		}
+		seen[property.Name] = true
+
+		if property.Default != "" {
+			if _, err := property.convert(property.Default); err != nil {
+				return fmt.Errorf("label %s: %v", l.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// property finds a declared property by name
+func (l Label) property(name string) (Property, bool) {
+	for _, property := range l.Properties {
+		if property.Name == name {
+			return property, true
+		}
+	}
+	return Property{}, false
+}
+
+// convert parses value into the property's type, rejecting anything it doesn't allow
+func (p Property) convert(value string) (interface{}, error) {
+	switch p.Type {
+	case PropertyInt:
+		converted, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, invalid("property %s must be an integer", p.Name)
+		}
+		return converted, nil
+	case PropertyFloat:
+		converted, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, invalid("property %s must be a number", p.Name)
+		}
+		return converted, nil
+	case PropertyBool:
+		converted, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, invalid("property %s must be true or false", p.Name)
+		}
+		return converted, nil
+	case PropertyString, "":
+		if len(p.Values) == 0 {
+			return value, nil
+		}
+		for _, allowed := range p.Values {
+			if value == allowed {
+				return value, nil
+			}
+		}
+		return nil, invalid("property %s cannot be %q", p.Name, value)
+	default:
+		return nil, fmt.Errorf("property %s has unknown type %s", p.Name, p.Type)
+	}
+}
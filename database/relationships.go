@@ -0,0 +1,341 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// relationshipTypePattern is the relationship type names that can be placed in a query, upper snake case
+var relationshipTypePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// Direction of the relationships read around a node
+type Direction int
+
+const (
+	DirectionBoth Direction = iota
+	DirectionOutgoing
+	DirectionIncoming
+)
+
+// Edge is a relationship between two nodes identified by their keys.
+// Since and Until bound when it is valid, Until is exclusive and either may be left open.
+type Edge struct {
+	Type   string
+	From   string
+	To     string
+	Since  *time.Time
+	Until  *time.Time
+	Role   string
+	Weight *float64
+}
+
+// EdgeRecord is an edge read back from the database with the properties of both of its nodes,
+// the keys of the nodes are in their properties rather than From and To
+type EdgeRecord struct {
+	Edge
+	FromNode map[string]string
+	ToNode   map[string]string
+}
+
+// EdgeQuery selects the relationships read around a node
+type EdgeQuery struct {
+	Direction Direction
+	// Types limits the relationship types, empty reads every type
+	Types []string
+	// AsOf only returns edges valid at that moment, nil returns them all
+	AsOf  *time.Time
+	Limit int64
+}
+
+// validAt is the Cypher predicate for edge alias being valid at $asOf, true for every edge when $asOf is null
+func validAt(alias string) string {
+	return "($asOf IS NULL OR ((" + alias + ".since IS NULL OR " + alias + ".since <= $asOf) AND (" + alias + ".until IS NULL OR " + alias + ".until > $asOf)))"
+}
+
+// overlaps is the Cypher predicate for edge x being valid at some moment between $since and $until
+const overlaps = "(x.since IS NULL OR $until IS NULL OR x.since < $until) AND (x.until IS NULL OR $since IS NULL OR x.until > $since)"
+
+// Relate creates the edge from a node of this repository to a node of target, or updates the edge of that type
+// between them whose validity overlaps the new one. Edges valid at other times are kept as the history of the
+// relationship, so asOf reads of the past still find them. Both nodes must be visible to the caller and the
+// edge must satisfy its catalogue entry, which is checked in the same transaction as the write.
+func (r *Repository) Relate(ctx context.Context, target *Repository, edge Edge) (*EdgeRecord, error) {
+	scope, err := scopeFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := edge.check(); err != nil {
+		return nil, err
+	}
+
+	relationshipType, ok := LookupRelationshipType(edge.Type)
+	if !ok {
+		return nil, invalid("unknown relationship type %s", edge.Type)
+	}
+	if err := relationshipType.checkLabels(r.label, target.label); err != nil {
+		return nil, err
+	}
+
+	queryData := map[string]interface{}{
+		"from":   r.keyValue(edge.From),
+		"to":     target.keyValue(edge.To),
+		"since":  timeParameter(edge.Since),
+		"until":  timeParameter(edge.Until),
+		"weight": nil,
+		"role":   nil,
+	}
+	if edge.Weight != nil {
+		queryData["weight"] = *edge.Weight
+	}
+	if edge.Role != "" {
+		queryData["role"] = edge.Role
+	}
+
+	match := "MATCH (a:" + r.label.Name + " {" + r.label.Key + ": $from}), (b:" + target.label.Name + " {" + target.label.Key + ": $to})" +
+		scopeWhere(scope, queryData, "a", "b")
+
+	// Write locks on both nodes, held to the end of the transaction, make concurrent relates of either node wait
+	// so the counts below can't be outdated by the time the edge is written. Two relates locking the same nodes
+	// in opposite order deadlock, which Neo4j reports as transient so Retry runs the loser again.
+	lock := match + " SET a._lock = true, b._lock = true REMOVE a._lock, b._lock"
+
+	// The other edges of the type each endpoint has during the new edge's validity, and the edges between
+	// the two nodes it overlaps, one of which it replaces
+	var check strings.Builder
+	check.WriteString(match)
+	check.WriteString(" RETURN " + relationshipType.From.propertyExpression("a") + " AS fromValue, ")
+	check.WriteString(relationshipType.To.propertyExpression("b") + " AS toValue, ")
+	check.WriteString("size([(a)-[x:" + edge.Type + "]->(o) WHERE o <> b AND " + overlaps + " | x]) AS fromCount, ")
+	check.WriteString("size([(o)-[x:" + edge.Type + "]->(b) WHERE o <> a AND " + overlaps + " | x]) AS toCount, ")
+	check.WriteString("[(a)-[x:" + edge.Type + "]->(b) WHERE " + overlaps + " | id(x)] AS overlapping")
+
+	// An edge valid at other times than every existing one starts a new period, otherwise the overlapping one changes
+	var create strings.Builder
+	create.WriteString(match)
+	create.WriteString(" CREATE (a)-[e:" + edge.Type + "]->(b)")
+	create.WriteString(" SET e.since = $since, e.until = $until, e.role = $role, e.weight = $weight")
+	create.WriteString(" RETURN a, e, b")
+
+	var update strings.Builder
+	update.WriteString(match)
+	update.WriteString(" MATCH (a)-[e:" + edge.Type + "]->(b) WHERE id(e) = $edge")
+	update.WriteString(" SET e.since = $since, e.until = $until, e.role = $role, e.weight = $weight")
+	update.WriteString(" RETURN a, e, b")
+
+	result, err := runTransaction(ctx, "relate", neo4j.AccessModeWrite, create.String(), queryData,
+		func(transaction neo4j.Transaction) (interface{}, error) {
+
+			// Don't start work for a caller that has gone away
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			lockResult, err := transaction.Run(lock, queryData)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := lockResult.Consume(); err != nil {
+				return nil, err
+			}
+
+			checkResult, err := transaction.Run(check.String(), queryData)
+			if err != nil {
+				return nil, err
+			}
+			if !checkResult.Next() {
+				if err := checkResult.Err(); err != nil {
+					return nil, err
+				}
+				return nil, ErrNotFound
+			}
+			values := checkResult.Record().Values
+
+			// Returning the error rolls the transaction back
+			if err := relationshipType.checkEndpoints(propertyString(values[0]), propertyString(values[1]), values[2].(int64), values[3].(int64)); err != nil {
+				return nil, err
+			}
+
+			write := create.String()
+			switch overlapping := values[4].([]interface{}); len(overlapping) {
+			case 0:
+			case 1:
+				write = update.String()
+				queryData["edge"] = overlapping[0]
+			default:
+				return nil, invalid("%s from %s to %s would overlap %d periods of the relationship, change them one at a time",
+					edge.Type, edge.From, edge.To, len(overlapping))
+			}
+
+			writeResult, err := transaction.Run(write, queryData)
+			if err != nil {
+				return nil, err
+			}
+			record, err := writeResult.Single()
+			if err != nil {
+				return nil, err
+			}
+
+			// Returning an error rolls the write back if the caller cancelled before the commit
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			return edgeFromRecord(record), nil
+		})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*EdgeRecord), nil
+}
+
+// Unrelate removes the edges of edgeType from a node of this repository to a node of target, every period
+// of the relationship included, it reports whether there was an edge to remove
+func (r *Repository) Unrelate(ctx context.Context, target *Repository, edgeType, from, to string) (bool, error) {
+	scope, err := scopeFromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := LookupRelationshipType(edgeType); !ok {
+		return false, invalid("unknown relationship type %s", edgeType)
+	}
+
+	queryData := map[string]interface{}{"from": r.keyValue(from), "to": target.keyValue(to)}
+
+	var query strings.Builder
+	query.WriteString("MATCH (a:" + r.label.Name + " {" + r.label.Key + ": $from})-[e:" + edgeType + "]->(b:" + target.label.Name + " {" + target.label.Key + ": $to})")
+	query.WriteString(scopeWhere(scope, queryData, "a", "b"))
+	query.WriteString(" DELETE e RETURN count(e) AS deleted")
+
+	records, err := recordsFromDB(ctx, "unrelate", neo4j.AccessModeWrite, query.String(), queryData)
+	if err != nil {
+		return false, err
+	}
+
+	return len(records) > 0 && records[0].Values[0].(int64) > 0, nil
+}
+
+// Edges returns the relationships of the node with key selected by edgeQuery, the other node may have any label
+// but must be visible to the caller. Edges are ordered by since so the history reads in order.
+func (r *Repository) Edges(ctx context.Context, key string, edgeQuery EdgeQuery) ([]EdgeRecord, error) {
+	scope, err := scopeFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkTypes(edgeQuery.Types); err != nil {
+		return nil, err
+	}
+
+	pattern := "(n)-[e]-(m)"
+	switch edgeQuery.Direction {
+	case DirectionOutgoing:
+		pattern = "(n)-[e]->(m)"
+	case DirectionIncoming:
+		pattern = "(n)<-[e]-(m)"
+	}
+
+	queryData := map[string]interface{}{"key": r.keyValue(key), "asOf": timeParameter(edgeQuery.AsOf)}
+
+	conditions := []string{validAt("e")}
+	if len(edgeQuery.Types) > 0 {
+		conditions = append(conditions, "type(e) IN $types")
+		queryData["types"] = edgeQuery.Types
+	}
+	if condition := scope.condition("n", queryData); condition != "" {
+		conditions = append(conditions, condition, "m."+InstitutionProperty+" = $"+scopeParameter)
+	}
+
+	var query strings.Builder
+	query.WriteString("MATCH (n:" + r.label.Name + " {" + r.label.Key + ": $key})")
+	query.WriteString(" MATCH " + pattern)
+	query.WriteString(" WHERE " + strings.Join(conditions, " AND "))
+	query.WriteString(" RETURN startNode(e) AS a, e, endNode(e) AS b")
+	query.WriteString(" ORDER BY e.since, id(e)")
+	if edgeQuery.Limit > 0 {
+		query.WriteString(fmt.Sprintf(" LIMIT %d", edgeQuery.Limit))
+	}
+
+	records, err := recordsFromDB(ctx, "edges", neo4j.AccessModeRead, query.String(), queryData)
+	if err != nil {
+		return nil, err
+	}
+
+	edges := make([]EdgeRecord, len(records))
+	for index, record := range records {
+		edges[index] = *edgeFromRecord(record)
+	}
+	return edges, nil
+}
+
+// check rejects an edge that can't be written
+func (e Edge) check() error {
+	if !relationshipTypePattern.MatchString(e.Type) {
+		return invalid("invalid relationship type %q", e.Type)
+	}
+	if e.Since != nil && e.Until != nil && !e.Until.After(*e.Since) {
+		return invalid("relationship until must be after since")
+	}
+	if e.Weight != nil && *e.Weight < 0 {
+		return invalid("relationship weight must not be negative")
+	}
+	return nil
+}
+
+// scopeWhere limits every alias to the caller's institution, empty when every institution is visible
+func scopeWhere(scope Scope, queryData map[string]interface{}, aliases ...string) string {
+	if scope.AllInstitutions {
+		return ""
+	}
+
+	conditions := make([]string, len(aliases))
+	for index, alias := range aliases {
+		conditions[index] = scope.condition(alias, queryData)
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// timeParameter passes an optional time to a query, nil becomes null
+func timeParameter(value *time.Time) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+// edgeFromRecord converts a record of start node, relationship and end node
+func edgeFromRecord(record *neo4j.Record) *EdgeRecord {
+	return edgeFromParts(record.Values[0].(neo4j.Node), record.Values[1].(neo4j.Relationship), record.Values[2].(neo4j.Node))
+}
+
+// edgeFromParts converts a relationship and the nodes at its ends
+func edgeFromParts(from neo4j.Node, relationship neo4j.Relationship, to neo4j.Node) *EdgeRecord {
+	edge := &EdgeRecord{
+		Edge:     Edge{Type: relationship.Type},
+		FromNode: nodeProperties(from),
+		ToNode:   nodeProperties(to),
+	}
+
+	if since, ok := relationship.Props["since"].(time.Time); ok {
+		edge.Since = &since
+	}
+	if until, ok := relationship.Props["until"].(time.Time); ok {
+		edge.Until = &until
+	}
+	if role, ok := relationship.Props["role"].(string); ok {
+		edge.Role = role
+	}
+	if weight, ok := relationship.Props["weight"].(float64); ok {
+		edge.Weight = &weight
+	}
+
+	return edge
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// Test declarations, registered once for the package's tests
+var (
+	testPeople = MustRegisterLabel(Label{Name: "TestPerson", Key: "id", Properties: []Property{{Name: "id", Type: PropertyString}}})
+	testKnows  = MustRegisterRelationshipType(RelationshipType{Name: "TEST_KNOWS", From: Endpoint{Label: "TestPerson"}, To: Endpoint{Label: "TestPerson"}})
+)
+
+func TestValidAt(t *testing.T) {
+	tests := []struct {
+		alias string
+		want  string
+	}{
+		{"e", "($asOf IS NULL OR ((e.since IS NULL OR e.since <= $asOf) AND (e.until IS NULL OR e.until > $asOf)))"},
+		{"x", "($asOf IS NULL OR ((x.since IS NULL OR x.since <= $asOf) AND (x.until IS NULL OR x.until > $asOf)))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alias, func(t *testing.T) {
+			if got := validAt(tt.alias); got != tt.want {
+				t.Errorf("validAt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopeWhere(t *testing.T) {
+	tests := []struct {
+		name    string
+		scope   Scope
+		aliases []string
+		want    string
+	}{
+		{"one alias", Scope{Institution: "north"}, []string{"a"}, " WHERE a.institution = $scopeInstitution"},
+		{"both ends", Scope{Institution: "north"}, []string{"a", "b"}, " WHERE a.institution = $scopeInstitution AND b.institution = $scopeInstitution"},
+		{"every institution", Scope{AllInstitutions: true}, []string{"a", "b"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scopeWhere(tt.scope, map[string]interface{}{}, tt.aliases...); got != tt.want {
+				t.Errorf("scopeWhere() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEdgeCheck(t *testing.T) {
+	since := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	until := since.AddDate(1, 0, 0)
+	negative := -1.0
+
+	tests := []struct {
+		name    string
+		edge    Edge
+		wantErr bool
+	}{
+		{"open", Edge{Type: "TUTORS"}, false},
+		{"bounded", Edge{Type: "TUTORS", Since: &since, Until: &until}, false},
+		{"invalid type", Edge{Type: "tutors"}, true},
+		{"until before since", Edge{Type: "TUTORS", Since: &until, Until: &since}, true},
+		{"empty period", Edge{Type: "TUTORS", Since: &since, Until: &since}, true},
+		{"negative weight", Edge{Type: "TUTORS", Weight: &negative}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.edge.check(); (err != nil) != tt.wantErr {
+				t.Errorf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRelateOverlappingPeriods(t *testing.T) {
+	tests := []struct {
+		name        string
+		overlapping []interface{}
+		wantWrite   string
+		wantErr     string
+	}{
+		{"new period", []interface{}{}, "CREATE (a)-[e:TEST_KNOWS]->(b)", ""},
+		{"one overlapping period", []interface{}{int64(7)}, "WHERE id(e) = $edge", ""},
+		{"several overlapping periods", []interface{}{int64(7), int64(8)}, "", "would overlap 2 periods"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := &fakeDriver{records: func(cypher string) []*neo4j.Record {
+				switch {
+				case strings.Contains(cypher, " AS overlapping"):
+					return []*neo4j.Record{{Values: []interface{}{nil, nil, int64(0), int64(0), tt.overlapping}}}
+				case strings.Contains(cypher, "RETURN a, e, b"):
+					return []*neo4j.Record{{Values: []interface{}{
+						neo4j.Node{Props: map[string]interface{}{"id": "p1"}},
+						neo4j.Relationship{Type: testKnows.Name},
+						neo4j.Node{Props: map[string]interface{}{"id": "p2"}},
+					}}}
+				}
+				return nil
+			}}
+			withDriver(t, driver)
+
+			ctx := WithScope(context.Background(), Scope{Institution: "north"})
+			_, err := testPeople.Relate(ctx, testPeople, Edge{Type: testKnows.Name, From: "p1", To: "p2"})
+
+			_, committed, _ := driver.state()
+			if tt.wantErr != "" {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Relate() error = %v, want a ValidationError about %q", err, tt.wantErr)
+				}
+				if len(committed) != 0 {
+					t.Errorf("committed = %v after a refused relate", committed)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Relate() error = %v", err)
+			}
+			if len(committed) != 3 || !strings.Contains(committed[2], tt.wantWrite) {
+				t.Errorf("committed = %v, want the lock, the check and a write with %q", committed, tt.wantWrite)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// ErrNotFound is returned by a repository when no node in the caller's scope has the key
+var ErrNotFound = errors.New("node not found")
+
+// Repository reads and writes the nodes of one registered label, values are validated and converted
+// to the declared types on the way in and returned as strings like the rest of the package
+type Repository struct {
+	label Label
+}
+
+// Label returns the declaration the repository works from
+func (r *Repository) Label() Label {
+	return r.label
+}
+
+// Save creates the node identified by the key in values or updates it if it already exists.
+// Properties left out of values keep their current value, or get their default when the node is new.
+func (r *Repository) Save(ctx context.Context, values map[string]string) (map[string]string, error) {
+	scope, err := scopeFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if values[r.label.Key] == "" {
+		return nil, invalid("%s %s is required", r.label.Name, r.label.Key)
+	}
+
+	// Whether the node is new isn't known until the write so required properties must always be given
+	for _, property := range r.label.Properties {
+		if property.Required && values[property.Name] == "" {
+			return nil, invalid("%s %s is required", r.label.Name, property.Name)
+		}
+	}
+
+	properties, err := r.convert(values)
+	if err != nil {
+		return nil, err
+	}
+
+	institution, err := scope.insertionInstitution(values[InstitutionProperty])
+	if err != nil {
+		return nil, err
+	}
+	properties[InstitutionProperty] = institution
+
+	defaults := make(map[string]interface{})
+	for _, property := range r.label.Properties {
+		if _, ok := properties[property.Name]; ok {
+			continue
+		}
+		if property.Default != "" {
+			defaults[property.Name], _ = property.convert(property.Default)
+		}
+	}
+
+	// Keys are unique across institutions, EnsureConstraints makes sure of it. The institution is checked after
+	// the MERGE has locked the node so a concurrent write from another institution can't slip in between.
+	queryData := map[string]interface{}{"key": properties[r.label.Key], "properties": properties, "defaults": defaults}
+	owner := ""
+	if !scope.AllInstitutions {
+		queryData[scopeParameter] = institution
+		owner = " WITH n WHERE n." + InstitutionProperty + " = $" + scopeParameter
+	}
+
+	query := "MERGE (n:" + r.label.Name + " {" + r.label.Key + ": $key})" +
+		" ON CREATE SET n += $defaults, n." + InstitutionProperty + " = $properties." + InstitutionProperty +
+		owner +
+		" SET n += $properties, " + bumpVersion +
+		" RETURN n"
+
+	nodes, err := r.writeVersioned(ctx, "save", query, queryData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only another institution's node is filtered out
+	if len(nodes) == 0 && !scope.AllInstitutions {
+		return nil, invalid("%s %s %v is already in use", r.label.Name, r.label.Key, properties[r.label.Key])
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%s write did not return a node", r.label.Name)
+	}
+	return nodes[0], nil
+}
+
+// Get returns the node with key, ErrNotFound when there isn't one in the caller's scope
+func (r *Repository) Get(ctx context.Context, key string) (map[string]string, error) {
+	nodes, err := r.List(ctx, map[string]string{r.label.Key: key}, 1, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, ErrNotFound
+	}
+	return nodes[0], nil
+}
+
+// Update changes the given properties of an existing node, ErrNotFound when there isn't one
+func (r *Repository) Update(ctx context.Context, key string, values map[string]string) (map[string]string, error) {
+	scope, err := scopeFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if changed, ok := values[r.label.Key]; ok && changed != key {
+		return nil, invalid("%s %s cannot be changed", r.label.Name, r.label.Key)
+	}
+
+	properties, err := r.convert(values)
+	if err != nil {
+		return nil, err
+	}
+
+	if requested, ok := values[InstitutionProperty]; ok {
+		institution, err := scope.insertionInstitution(requested)
+		if err != nil {
+			return nil, err
+		}
+		properties[InstitutionProperty] = institution
+	}
+
+	for _, property := range r.label.Properties {
+		if value, ok := properties[property.Name]; ok && property.Required && value == nil {
+			return nil, invalid("%s %s is required", r.label.Name, property.Name)
+		}
+	}
+
+	queryData := map[string]interface{}{"key": r.keyValue(key), "properties": properties}
+	where := ""
+	if condition := scope.condition("n", queryData); condition != "" {
+		where = " WHERE " + condition
+	}
+
+	query := "MATCH (n:" + r.label.Name + " {" + r.label.Key + ": $key})" + where +
+		" SET n += $properties, " + bumpVersion +
+		" RETURN n"
+
+	nodes, err := r.writeVersioned(ctx, "update", query, queryData)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, ErrNotFound
+	}
+	return nodes[0], nil
+}
+
+// Delete removes the node with key and its relationships, it reports whether there was a node to remove
+func (r *Repository) Delete(ctx context.Context, key string) (bool, error) {
+	scope, err := scopeFromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	queryData := map[string]interface{}{"key": r.keyValue(key)}
+	where := ""
+	if condition := scope.condition("n", queryData); condition != "" {
+		where = " WHERE " + condition
+	}
+
+	match := "MATCH (n:" + r.label.Name + " {" + r.label.Key + ": $key})" + where
+
+	// The last state is kept in the history before the node goes
+	deleted, err := runTransaction(ctx, "delete", neo4j.AccessModeWrite, match+" DETACH DELETE n", queryData,
+		func(transaction neo4j.Transaction) (interface{}, error) {
+
+			// Don't start work for a caller that has gone away
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			matchResult, err := transaction.Run(match+" RETURN n", queryData)
+			if err != nil {
+				return nil, err
+			}
+			records, err := matchResult.Collect()
+			if err != nil {
+				return nil, err
+			}
+
+			for _, record := range records {
+				if err := recordVersion(ctx, transaction, r.label.Name, r.label.Key, record.Values[0].(neo4j.Node), true); err != nil {
+					return nil, err
+				}
+			}
+
+			deleteResult, err := transaction.Run(match+" DETACH DELETE n", queryData)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := deleteResult.Consume(); err != nil {
+				return nil, err
+			}
+
+			return len(records) > 0, ctx.Err()
+		})
+
+	if err != nil {
+		return false, err
+	}
+
+	return deleted.(bool), nil
+}
+
+// List returns the nodes whose properties equal filters, sorted by orderBy then the key and capped at limit when it is above zero
+func (r *Repository) List(ctx context.Context, filters map[string]string, limit int64, orderBy []SortField) ([]map[string]string, error) {
+	scope, err := scopeFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	properties, err := r.convert(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var conditions []string
+	queryData := make(map[string]interface{})
+	for name, value := range properties {
+		if value == nil {
+			conditions = append(conditions, "n."+name+" IS NULL")
+			continue
+		}
+		conditions = append(conditions, "n."+name+" = $"+name)
+		queryData[name] = value
+	}
+	if condition := scope.condition("n", queryData); condition != "" {
+		conditions = append(conditions, condition)
+	}
+
+	ordering, err := orderByClause("n", orderBy, r.label.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	var query strings.Builder
+	query.WriteString("MATCH (n:" + r.label.Name + ")")
+	if len(conditions) > 0 {
+		query.WriteString(" WHERE " + strings.Join(conditions, " AND "))
+	}
+	query.WriteString(" RETURN n")
+	query.WriteString(ordering)
+	if limit > 0 {
+		query.WriteString(" LIMIT " + strconv.FormatInt(limit, 10))
+	}
+
+	nodes, err := readNodesFromDB(ctx, query.String(), queryData)
+	if err != nil {
+		return nil, err
+	}
+	return *nodes, nil
+}
+
+// convert validates values against the declaration and converts them to the declared types,
+// an empty value for an optional property removes it
+func (r *Repository) convert(values map[string]string) (map[string]interface{}, error) {
+	properties := make(map[string]interface{}, len(values))
+
+	for name, value := range values {
+		if name == InstitutionProperty {
+			continue
+		}
+
+		property, ok := r.label.property(name)
+		if !ok {
+			return nil, invalid("%s has no property %s", r.label.Name, name)
+		}
+
+		if value == "" {
+			properties[name] = nil
+			continue
+		}
+
+		converted, err := property.convert(value)
+		if err != nil {
+			return nil, err
+		}
+		properties[name] = converted
+	}
+
+	return properties, nil
+}
+
+// keyValue converts a key to its declared type falling back to the string when it doesn't parse,
+// it then simply matches nothing
+func (r *Repository) keyValue(key string) interface{} {
+	property, _ := r.label.property(r.label.Key)
+	if converted, err := property.convert(key); err == nil {
+		return converted
+	}
+	return key
+}
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/sirupsen/logrus"
+	"gql/logging"
+	"gql/metrics"
+)
+
+// ErrUnavailable is returned without touching the database while the circuit breaker is open
+var ErrUnavailable = errors.New("database unavailable")
+
+// RetryPolicy retries transactions that failed for a transient reason, on top of the driver's own retries
+// within a managed transaction. Backoff doubles from InitialBackoff up to MaxBackoff with jitter.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Retry is the policy every transaction runs under, one attempt means no retries
+var Retry = RetryPolicy{MaxAttempts: 3, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 2 * time.Second}
+
+// Breaker fast fails transactions while the database is down
+var Breaker = NewCircuitBreaker(5, 30*time.Second)
+
+// backoff returns the wait before the given retry, counting from one
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	wait := p.InitialBackoff
+	for i := 1; i < retry && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+
+	// Up to half the wait again so retrying clients don't arrive together
+	if wait > 0 {
+		wait += time.Duration(rand.Int63n(int64(wait)/2 + 1))
+	}
+	return wait
+}
+
+// withRetry runs attempt until it succeeds, fails for a non transient reason, runs out of attempts or ctx ends.
+// Every attempt passes through the circuit breaker.
+func (p RetryPolicy) withRetry(ctx context.Context, function string, attempt func() (interface{}, error)) (interface{}, error) {
+	var value interface{}
+	var err error
+
+	for try := 1; ; try++ {
+		if !Breaker.allow() {
+			return nil, ErrUnavailable
+		}
+
+		value, err = attempt()
+		Breaker.record(err)
+
+		if err == nil || !isTransient(err) || try >= p.MaxAttempts {
+			return value, err
+		}
+
+		wait := p.backoff(try)
+		logging.FromContext(ctx).WithFields(logrus.Fields{"function": function, "attempt": try, "wait_ms": wait.Milliseconds()}).
+			WithError(err).Warn("retrying transient neo4j failure")
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// isTransient reports whether a failure is likely to go away on its own, such as a lost connection or a leader change
+func isTransient(err error) bool {
+	var neo4jErr *neo4j.Neo4jError
+	if errors.As(err, &neo4jErr) {
+		return neo4jErr.Classification() == "TransientError"
+	}
+
+	return neo4j.IsConnectivityError(err) || neo4j.IsTransactionExecutionLimit(err)
+}
+
+// Circuit breaker states
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreaker opens after FailureThreshold consecutive transient failures and rejects calls for Cooldown,
+// then lets a single trial call through, closing again if it succeeds
+type CircuitBreaker struct {
+	FailureThreshold int
+	Cooldown         time.Duration
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// NewCircuitBreaker creates a closed breaker
+func NewCircuitBreaker(failureThreshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{FailureThreshold: failureThreshold, Cooldown: cooldown}
+}
+
+// allow reports whether a call may go to the database
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.Cooldown {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		b.trial = true
+		return true
+	case breakerHalfOpen:
+		// One trial at a time
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+
+	return true
+}
+
+// record updates the breaker with the outcome of a call, only transient failures count against the database
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// A caller giving up says nothing about the database
+	if isContextError(err) {
+		if b.state == breakerHalfOpen {
+			b.trial = false
+		}
+		return
+	}
+
+	failed := err != nil && isTransient(err)
+
+	if b.state == breakerHalfOpen {
+		b.trial = false
+		if failed {
+			b.trip()
+		} else {
+			b.failures = 0
+			b.setState(breakerClosed)
+			logrus.Info("neo4j circuit breaker closed")
+		}
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerClosed && b.failures >= b.FailureThreshold {
+		b.trip()
+	}
+}
+
+// trip opens the breaker, the caller holds the lock
+func (b *CircuitBreaker) trip() {
+	b.openedAt = time.Now()
+	b.setState(breakerOpen)
+	metrics.BreakerTripped()
+	logrus.WithFields(logrus.Fields{"failures": b.failures, "cooldown": b.Cooldown.String()}).
+		Error("neo4j circuit breaker opened")
+}
+
+// setState changes state and publishes it, the caller holds the lock
+func (b *CircuitBreaker) setState(state int) {
+	b.state = state
+	metrics.BreakerState(state)
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+var (
+	errTransient = &neo4j.Neo4jError{Code: "Neo.TransientError.General.DatabaseUnavailable"}
+	errClient    = &neo4j.Neo4jError{Code: "Neo.ClientError.Statement.SyntaxError"}
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"transient", errTransient, true},
+		{"wrapped transient", fmt.Errorf("relate: %w", errTransient), true},
+		{"client", errClient, false},
+		{"other", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.want {
+				t.Errorf("isTransient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	tests := []struct {
+		retry int
+		base  time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{10, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.retry), func(t *testing.T) {
+			// Jitter adds up to half the wait again
+			for i := 0; i < 20; i++ {
+				if got := policy.backoff(tt.retry); got < tt.base || got > tt.base+tt.base/2 {
+					t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.retry, got, tt.base, tt.base+tt.base/2)
+				}
+			}
+		})
+	}
+}
+
+// withBreaker runs the test with its own breaker in place of the package one
+func withBreaker(t *testing.T, breaker *CircuitBreaker) {
+	previous := Breaker
+	Breaker = breaker
+	t.Cleanup(func() { Breaker = previous })
+}
+
+func TestWithRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	tests := []struct {
+		name         string
+		failures     []error
+		wantErr      error
+		wantAttempts int
+	}{
+		{"succeeds first time", nil, nil, 1},
+		{"retries transient failures", []error{errTransient, errTransient}, nil, 3},
+		{"gives up after max attempts", []error{errTransient, errTransient, errTransient}, errTransient, 3},
+		{"does not retry client errors", []error{errClient}, errClient, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withBreaker(t, NewCircuitBreaker(100, time.Minute))
+
+			attempts := 0
+			_, err := policy.withRetry(context.Background(), "test", func() (interface{}, error) {
+				attempts++
+				if attempts <= len(tt.failures) {
+					return nil, tt.failures[attempts-1]
+				}
+				return "done", nil
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("withRetry() error = %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("withRetry() made %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestWithRetryStopsWhenBreakerOpens(t *testing.T) {
+	withBreaker(t, NewCircuitBreaker(2, time.Minute))
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	attempts := 0
+	_, err := policy.withRetry(context.Background(), "test", func() (interface{}, error) {
+		attempts++
+		return nil, errTransient
+	})
+
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("withRetry() error = %v, want ErrUnavailable", err)
+	}
+	if attempts != 2 {
+		t.Errorf("withRetry() made %d attempts, want 2", attempts)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := NewCircuitBreaker(2, 10*time.Millisecond)
+
+	// Client errors and cancellations don't count against the database
+	breaker.record(errClient)
+	breaker.record(context.Canceled)
+	breaker.record(errTransient)
+	if !breaker.allow() {
+		t.Fatal("breaker opened before the threshold")
+	}
+
+	breaker.record(errTransient)
+	if breaker.allow() {
+		t.Fatal("breaker allowed a call while open")
+	}
+
+	time.Sleep(15 * time.Millisecond)
+	if !breaker.allow() {
+		t.Fatal("breaker refused the trial call after the cooldown")
+	}
+	if breaker.allow() {
+		t.Fatal("breaker allowed a second call during the trial")
+	}
+
+	// A failed trial opens it again
+	breaker.record(errTransient)
+	if breaker.allow() {
+		t.Fatal("breaker allowed a call after a failed trial")
+	}
+
+	time.Sleep(15 * time.Millisecond)
+	if !breaker.allow() {
+		t.Fatal("breaker refused the second trial call")
+	}
+	breaker.record(nil)
+	if !breaker.allow() || !breaker.allow() {
+		t.Fatal("breaker did not close after a successful trial")
+	}
+}
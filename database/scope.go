@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"errors"
+)
+
+// InstitutionProperty tags every node with the institution (tenant) it belongs to
+const InstitutionProperty = "institution"
+
+// scopeParameter is the query parameter holding the caller's institution
+const scopeParameter = "scopeInstitution"
+
+// Scope limits the nodes a request may read or write to one institution unless AllInstitutions is set
+type Scope struct {
+	Institution     string
+	AllInstitutions bool
+}
+
+// ErrUnscoped is returned for every query of a request that has no scope, normally an anonymous one
+var ErrUnscoped = errors.New("request is not scoped to an institution")
+
+type scopeKey struct{}
+
+// WithScope stores the tenant scope every query built from ctx is limited to
+func WithScope(ctx context.Context, scope Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ScopeOf returns the scope stored by WithScope, false when the request has none
+func ScopeOf(ctx context.Context) (Scope, bool) {
+	scope, ok := ctx.Value(scopeKey{}).(Scope)
+	return scope, ok
+}
+
+// scopeFromContext returns the request's scope, queries are refused when there is none
+func scopeFromContext(ctx context.Context) (Scope, error) {
+	scope, ok := ScopeOf(ctx)
+	if !ok || (!scope.AllInstitutions && scope.Institution == "") {
+		return Scope{}, ErrUnscoped
+	}
+	return scope, nil
+}
+
+// condition returns the Cypher predicate limiting alias to the scope, empty when every institution is visible
+func (s Scope) condition(alias string, queryData map[string]interface{}) string {
+	if s.AllInstitutions {
+		return ""
+	}
+	queryData[scopeParameter] = s.Institution
+	return alias + "." + InstitutionProperty + " = $" + scopeParameter
+}
+
+// insertionInstitution works out the institution a written node belongs to.
+// Only a request scoped to every institution may choose one other than its own.
+func (s Scope) insertionInstitution(requested string) (string, error) {
+	if s.AllInstitutions {
+		if requested == "" {
+			requested = s.Institution
+		}
+		if requested == "" {
+			return "", invalid("an institution is required")
+		}
+		return requested, nil
+	}
+
+	if requested != "" && requested != s.Institution {
+		return "", forbidden("cannot write to institution %s", requested)
+	}
+
+	return s.Institution, nil
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestScopeFromContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		wantErr bool
+	}{
+		{"no scope", context.Background(), true},
+		{"institution", WithScope(context.Background(), Scope{Institution: "north"}), false},
+		{"every institution", WithScope(context.Background(), Scope{AllInstitutions: true}), false},
+		{"empty institution", WithScope(context.Background(), Scope{}), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := scopeFromContext(tt.ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("scopeFromContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrUnscoped) {
+				t.Errorf("scopeFromContext() error = %v, want ErrUnscoped", err)
+			}
+		})
+	}
+}
+
+func TestScopeCondition(t *testing.T) {
+	queryData := map[string]interface{}{}
+	if got := (Scope{Institution: "north"}).condition("n", queryData); got != "n.institution = $scopeInstitution" {
+		t.Errorf("condition() = %q", got)
+	}
+	if queryData[scopeParameter] != "north" {
+		t.Errorf("condition() parameter = %v, want north", queryData[scopeParameter])
+	}
+
+	queryData = map[string]interface{}{}
+	if got := (Scope{Institution: "north", AllInstitutions: true}).condition("n", queryData); got != "" {
+		t.Errorf("condition() across institutions = %q, want none", got)
+	}
+	if _, ok := queryData[scopeParameter]; ok {
+		t.Errorf("condition() across institutions set a parameter")
+	}
+}
+
+func TestInsertionInstitution(t *testing.T) {
+	tests := []struct {
+		name      string
+		scope     Scope
+		requested string
+		want      string
+		wantErr   error
+	}{
+		{"own institution by default", Scope{Institution: "north"}, "", "north", nil},
+		{"own institution requested", Scope{Institution: "north"}, "north", "north", nil},
+		{"another institution refused", Scope{Institution: "north"}, "south", "", &ForbiddenError{}},
+		{"super admin chooses", Scope{Institution: "north", AllInstitutions: true}, "south", "south", nil},
+		{"super admin defaults to own", Scope{Institution: "north", AllInstitutions: true}, "", "north", nil},
+		{"super admin without any", Scope{AllInstitutions: true}, "", "", &ValidationError{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.scope.insertionInstitution(tt.requested)
+			if (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("insertionInstitution() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && reflect.TypeOf(err) != reflect.TypeOf(tt.wantErr) {
+				t.Errorf("insertionInstitution() error = %T, want %T", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("insertionInstitution() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
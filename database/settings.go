@@ -0,0 +1,81 @@
+package database
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Encryption modes for DriverSettings
+const (
+	// EncryptionUri uses whatever the URI scheme asks for
+	EncryptionUri = "uri"
+	// EncryptionOff connects in plain text
+	EncryptionOff = "off"
+	// EncryptionSystem encrypts and verifies the server against the system or configured CA certificates
+	EncryptionSystem = "system"
+	// EncryptionTrustAll encrypts but accepts any certificate, for self signed development servers
+	EncryptionTrustAll = "trust-all"
+)
+
+// databaseName is the database every session runs against, empty means the server default
+var databaseName string
+
+// DriverSettings tunes the driver connection pool and security, zero values keep the driver defaults
+type DriverSettings struct {
+	DatabaseName                 string
+	MaxConnectionPoolSize        int
+	ConnectionAcquisitionTimeout time.Duration
+	MaxConnectionLifetime        time.Duration
+	Encryption                   string
+	CaCertFile                   string
+}
+
+// targetUri rewrites the URI scheme to carry the chosen encryption, the driver reads encryption from the scheme
+func (s DriverSettings) targetUri(uri string) (string, error) {
+	if s.Encryption == "" || s.Encryption == EncryptionUri {
+		return uri, nil
+	}
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid neo4j uri: %w", err)
+	}
+
+	base := strings.SplitN(parsed.Scheme, "+", 2)[0]
+
+	switch s.Encryption {
+	case EncryptionOff:
+		parsed.Scheme = base
+	case EncryptionSystem:
+		parsed.Scheme = base + "+s"
+	case EncryptionTrustAll:
+		parsed.Scheme = base + "+ssc"
+	default:
+		return "", fmt.Errorf("unknown neo4j encryption %q", s.Encryption)
+	}
+
+	return parsed.String(), nil
+}
+
+// rootCAs loads the CA certificates used to verify the server, nil means use the system pool
+func (s DriverSettings) rootCAs() (*x509.CertPool, error) {
+	if s.CaCertFile == "" {
+		return nil, nil
+	}
+
+	pem, err := ioutil.ReadFile(s.CaCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read neo4j CA certificate: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", s.CaCertFile)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// SnapshotQuery selects the relationships loaded into a snapshot
+type SnapshotQuery struct {
+	// Types limits the relationships loaded, empty loads every type
+	Types []string
+	// AsOf only loads relationships valid at that moment, nil loads them all
+	AsOf *time.Time
+}
+
+// Snapshot loads every node of this label visible to the caller and the relationships between them in
+// one read transaction, so analyses that need the whole graph can run over it in memory.
+// The nodes of an edge are the same maps as in Nodes.
+func (r *Repository) Snapshot(ctx context.Context, snapshotQuery SnapshotQuery) (*Subgraph, error) {
+	scope, err := scopeFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkTypes(snapshotQuery.Types); err != nil {
+		return nil, err
+	}
+
+	queryData := map[string]interface{}{"asOf": timeParameter(snapshotQuery.AsOf), "types": typesParameter(snapshotQuery.Types)}
+
+	nodeQuery := "MATCH (n:" + r.label.Name + ")" + scopeWhere(scope, queryData, "n") + " RETURN n"
+
+	edgeConditions := []string{"(size($types) = 0 OR type(e) IN $types)", validAt("e")}
+	if condition := scopeWhere(scope, queryData, "a", "b"); condition != "" {
+		edgeConditions = append(edgeConditions, strings.TrimPrefix(condition, " WHERE "))
+	}
+	edgeQuery := "MATCH (a:" + r.label.Name + ")-[e]->(b:" + r.label.Name + ")" +
+		" WHERE " + strings.Join(edgeConditions, " AND ") +
+		" RETURN id(a), e, id(b)"
+
+	result, err := runTransaction(ctx, "snapshot", neo4j.AccessModeRead, nodeQuery+"; "+edgeQuery, queryData,
+		func(transaction neo4j.Transaction) (interface{}, error) {
+
+			// Don't start work for a caller that has gone away
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			subgraph := &Subgraph{}
+			nodes := make(map[int64]map[string]string)
+
+			nodeResult, err := transaction.Run(nodeQuery, queryData)
+			if err != nil {
+				return nil, err
+			}
+			for nodeResult.Next() {
+				node := nodeResult.Record().Values[0].(neo4j.Node)
+				nodes[node.Id] = nodeProperties(node)
+				subgraph.Nodes = append(subgraph.Nodes, nodes[node.Id])
+			}
+			if err := nodeResult.Err(); err != nil {
+				return nil, err
+			}
+
+			edgeResult, err := transaction.Run(edgeQuery, queryData)
+			if err != nil {
+				return nil, err
+			}
+			for edgeResult.Next() {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+
+				values := edgeResult.Record().Values
+				edge := edgeFromParts(neo4j.Node{}, values[1].(neo4j.Relationship), neo4j.Node{})
+				edge.FromNode = nodes[values[0].(int64)]
+				edge.ToNode = nodes[values[2].(int64)]
+				subgraph.Edges = append(subgraph.Edges, *edge)
+			}
+
+			return subgraph, edgeResult.Err()
+		})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*Subgraph), nil
+}
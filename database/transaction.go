@@ -0,0 +1,190 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"gql/logging"
+	"gql/metrics"
+	"gql/tracing"
+	"sync"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryTimeout is the longest any transaction may run, a shorter deadline on the caller's context takes priority
+var QueryTimeout = 10 * time.Second
+
+// inFlight counts transactions that have not finished, CloseDriver waits for them so cancelled
+// requests can still roll back and completed mutations can still commit.
+// closing is set by CloseDriver, after which no transaction may start, and drained is closed once
+// the last transaction running at that point has finished.
+var (
+	closingMu sync.Mutex
+	inFlight  int
+	closing   bool
+	drained   chan struct{}
+)
+
+// startTransaction counts a transaction into inFlight, false once the driver is closing
+func startTransaction() bool {
+	closingMu.Lock()
+	defer closingMu.Unlock()
+
+	if closing {
+		return false
+	}
+
+	inFlight++
+	return true
+}
+
+// finishTransaction counts a transaction out of inFlight, letting CloseDriver go on after the last one
+func finishTransaction() {
+	closingMu.Lock()
+	defer closingMu.Unlock()
+
+	inFlight--
+	if closing && inFlight == 0 {
+		close(drained)
+	}
+}
+
+// transactionResult carries the outcome of a transaction back from its thread
+type transactionResult struct {
+	value interface{}
+	err   error
+}
+
+// runTransaction runs work in a managed transaction on a new session that follows the request's bookmarks,
+// or in the caller's transaction when ctx comes from InTransaction.
+// Transient failures are retried under Retry and nothing is attempted while Breaker is open.
+// Each attempt is given a server side timeout from QueryTimeout or the context deadline, and the caller
+// gets ctx.Err() as soon as the context is cancelled while the transaction rolls back on its own thread.
+func runTransaction(ctx context.Context, function string, accessMode neo4j.AccessMode, cypher string, params map[string]interface{}, work neo4j.TransactionWork) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Inside a unit of work the query joins its transaction, retries and commit are the unit's
+	if unit := unitFromContext(ctx); unit != nil {
+		return work(unit.transaction)
+	}
+
+	// Requests still running after the server stopped waiting for them get nothing new started
+	if !startTransaction() {
+		return nil, ErrUnavailable
+	}
+
+	done := make(chan transactionResult, 1)
+
+	go func() {
+		defer finishTransaction()
+
+		var result transactionResult
+		result.value, result.err = Retry.withRetry(ctx, function, func() (interface{}, error) {
+			return runSession(ctx, function, accessMode, cypher, params, work)
+		})
+
+		done <- result
+	}()
+
+	select {
+	case result := <-done:
+		return result.value, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// runSession makes one attempt at a transaction on its own session
+func runSession(ctx context.Context, function string, accessMode neo4j.AccessMode, cypher string, params map[string]interface{}, work neo4j.TransactionWork) (interface{}, error) {
+	timeout, err := transactionTimeout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := "read"
+	if accessMode == neo4j.AccessModeWrite {
+		mode = "write"
+	}
+
+	// Open session
+	session := Driver.NewSession(neo4j.SessionConfig{
+		AccessMode:   accessMode,
+		DatabaseName: databaseName,
+		Bookmarks:    Bookmarks(ctx),
+	})
+	defer metrics.SessionOpened(mode)()
+	defer func(session neo4j.Session) {
+		err := session.Close()
+		if err != nil {
+			logging.FromContext(ctx).WithError(err).Warn("cannot close neo4j session")
+		}
+	}(session)
+
+	start := time.Now()
+	_, span := tracing.StartQuery(ctx, function, mode, cypher, params)
+
+	var result transactionResult
+	if accessMode == neo4j.AccessModeWrite {
+		result.value, result.err = session.WriteTransaction(work, neo4j.WithTxTimeout(timeout))
+
+		// Later reads in this request, and the client's next request, must see this write
+		if result.err == nil {
+			recordBookmark(ctx, session.LastBookmark())
+		}
+	} else {
+		result.value, result.err = session.ReadTransaction(work, neo4j.WithTxTimeout(timeout))
+	}
+
+	finishQuery(ctx, span, function, mode, start, result.err)
+
+	return result.value, result.err
+}
+
+// transactionTimeout returns the server side timeout for a transaction started now
+func transactionTimeout(ctx context.Context) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	timeout := QueryTimeout
+
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return 0, context.DeadlineExceeded
+		}
+		if remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	return timeout, nil
+}
+
+// isContextError reports whether err came from a cancelled or expired context
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// finishQuery records the metrics, span and log entry for a completed transaction
+func finishQuery(ctx context.Context, span trace.Span, function, mode string, start time.Time, err error) {
+	metrics.ObserveQuery(function, mode, start, err)
+	tracing.End(span, err)
+
+	entry := logging.FromContext(ctx).WithFields(logrus.Fields{
+		"function":    function,
+		"mode":        mode,
+		"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+	})
+
+	if err != nil {
+		entry.WithError(err).Error("cypher transaction failed")
+	} else {
+		entry.Debug("cypher transaction completed")
+	}
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTransactionTimeout(t *testing.T) {
+	previous := QueryTimeout
+	QueryTimeout = time.Minute
+	t.Cleanup(func() { QueryTimeout = previous })
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		min     time.Duration
+		max     time.Duration
+		wantErr error
+	}{
+		{"no deadline", func() (context.Context, context.CancelFunc) {
+			return context.Background(), func() {}
+		}, time.Minute, time.Minute, nil},
+		{"shorter deadline", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), time.Second)
+		}, time.Second / 2, time.Second, nil},
+		{"longer deadline", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), time.Hour)
+		}, time.Minute, time.Minute, nil},
+		{"deadline passed", func() (context.Context, context.CancelFunc) {
+			return context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		}, 0, 0, context.DeadlineExceeded},
+		{"cancelled", func() (context.Context, context.CancelFunc) {
+			return cancelled, func() {}
+		}, 0, 0, context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			got, err := transactionTimeout(ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("transactionTimeout() error = %v, want %v", err, tt.wantErr)
+			}
+			if got < tt.min || got > tt.max {
+				t.Errorf("transactionTimeout() = %v, want between %v and %v", got, tt.min, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"context"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+type unitKey struct{}
+
+// unitOfWork is the transaction shared by every query made with a context from InTransaction
+type unitOfWork struct {
+	transaction neo4j.Transaction
+}
+
+// InTransaction runs fn so that every query it makes with the context it is given goes through one write
+// transaction, committed when fn returns nil and rolled back when it returns an error.
+// The whole of fn is retried on a transient failure so it must not have effects outside the database.
+// Calls nested inside a unit of work join it.
+func InTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if unitFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	_, err := runTransaction(ctx, "unitOfWork", neo4j.AccessModeWrite, "", nil,
+		func(transaction neo4j.Transaction) (interface{}, error) {
+			return nil, fn(context.WithValue(ctx, unitKey{}, &unitOfWork{transaction: transaction}))
+		})
+
+	return err
+}
+
+// unitFromContext returns the unit of work ctx belongs to, nil outside one
+func unitFromContext(ctx context.Context) *unitOfWork {
+	unit, _ := ctx.Value(unitKey{}).(*unitOfWork)
+	return unit
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+func TestInTransaction(t *testing.T) {
+	tests := []struct {
+		name          string
+		statements    []string
+		fail          string
+		wantErr       error
+		wantRan       int
+		wantCommitted []string
+	}{
+		{"every statement commits", []string{"CREATE (a)", "CREATE (b)", "CREATE (c)"}, "", nil, 3, []string{"CREATE (a)", "CREATE (b)", "CREATE (c)"}},
+		{"a failure rolls back the earlier statements", []string{"CREATE (a)", "CREATE (b)", "CREATE (c)"}, "(c)", errStatementFailed, 2, nil},
+		{"a failure stops the later statements", []string{"CREATE (a)", "CREATE (b)", "CREATE (c)"}, "(a)", errStatementFailed, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := &fakeDriver{fail: tt.fail}
+			withDriver(t, driver)
+
+			ran := 0
+			err := InTransaction(context.Background(), func(ctx context.Context) error {
+				for _, statement := range tt.statements {
+					if _, err := recordsFromDB(ctx, "test", neo4j.AccessModeWrite, statement, nil); err != nil {
+						return err
+					}
+					ran++
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("InTransaction() error = %v, want %v", err, tt.wantErr)
+			}
+
+			sessions, committed, _ := driver.state()
+			if sessions != 1 {
+				t.Errorf("sessions = %d, want every statement in one", sessions)
+			}
+			if !reflect.DeepEqual(committed, tt.wantCommitted) {
+				t.Errorf("committed = %v, want %v", committed, tt.wantCommitted)
+			}
+			if ran != tt.wantRan {
+				t.Errorf("ran %d statements, want %d", ran, tt.wantRan)
+			}
+		})
+	}
+}
+
+func TestInTransactionNested(t *testing.T) {
+	driver := &fakeDriver{}
+	withDriver(t, driver)
+
+	err := InTransaction(context.Background(), func(ctx context.Context) error {
+		if _, err := recordsFromDB(ctx, "test", neo4j.AccessModeWrite, "CREATE (a)", nil); err != nil {
+			return err
+		}
+		return InTransaction(ctx, func(ctx context.Context) error {
+			_, err := recordsFromDB(ctx, "test", neo4j.AccessModeWrite, "CREATE (b)", nil)
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sessions, committed, _ := driver.state(); sessions != 1 || len(committed) != 2 {
+		t.Errorf("sessions = %d, committed = %v, want the nested unit to join the outer one", sessions, committed)
+	}
+}
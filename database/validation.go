@@ -0,0 +1,33 @@
+package database
+
+import "fmt"
+
+// ValidationError is returned when a write is refused because of what was asked for rather than a database
+// failure, its message is meant for the client
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// invalid returns a ValidationError with a formatted message
+func invalid(format string, args ...interface{}) error {
+	return &ValidationError{Message: fmt.Sprintf(format, args...)}
+}
+
+// ForbiddenError is returned when the caller may not make a write they are otherwise allowed to ask for,
+// its message is meant for the client
+type ForbiddenError struct {
+	Message string
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.Message
+}
+
+// forbidden returns a ForbiddenError with a formatted message
+func forbidden(format string, args ...interface{}) error {
+	return &ForbiddenError{Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gql/auth"
+	"gql/database"
+	"gql/graph"
+	"gql/graph/model"
+	"gql/logging"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* Fill colour of each user type in every export format */
+var userTypeColours = map[model.UserType]string{
+	model.UserTypeSuperAdmin:  "#6a3d9a",
+	model.UserTypeAdmin:       "#1f78b4",
+	model.UserTypeTutor:       "#33a02c",
+	model.UserTypeStudent:     "#ff7f00",
+	model.UserTypeUnvalidated: "#b2b2b2",
+	model.UserTypeSuspended:   "#e31a1c",
+	model.UserTypeRetired:     "#8c8c8c",
+	model.UserTypeDelete:      "#4d4d4d",
+}
+
+const defaultColour = "#cccccc"
+
+/* Set on an export that hit the neighbourhood cap, the Cytoscape format has nowhere else to say so */
+const truncatedHeader = "X-Graph-Truncated"
+
+/* Cytoscape.js elements JSON */
+type cytoscapeElement struct {
+	Group   string                 `json:"group"`
+	Data    map[string]interface{} `json:"data"`
+	Classes string                 `json:"classes,omitempty"`
+}
+
+/* D3 force layout JSON */
+type d3Graph struct {
+	Nodes     []map[string]interface{} `json:"nodes"`
+	Links     []map[string]interface{} `json:"links"`
+	Truncated bool                     `json:"truncated"`
+}
+
+/*
+Serves GET /graph?root=<uuid>&depth=2&format=cytoscape|d3|dot, the neighbourhood of a user in a form
+the front-end or Graphviz renders directly. types (comma separated) and asOf (RFC 3339) narrow the
+relationships followed like the neighbourhood query.
+*/
+func graphExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	root := query.Get("root")
+	if root == "" {
+		http.Error(w, "root is required", http.StatusBadRequest)
+		return
+	}
+
+	neighbourhoodQuery := database.NeighbourhoodQuery{Depth: 2}
+
+	if depth := query.Get("depth"); depth != "" {
+		parsed, err := strconv.Atoi(depth)
+		if err != nil {
+			http.Error(w, "depth must be a number", http.StatusBadRequest)
+			return
+		}
+		neighbourhoodQuery.Depth = parsed
+	}
+
+	if types := query.Get("types"); types != "" {
+		neighbourhoodQuery.Types = strings.Split(types, ",")
+	}
+
+	if asOf := query.Get("asOf"); asOf != "" {
+		parsed, err := time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			http.Error(w, "asOf must be an RFC 3339 date and time", http.StatusBadRequest)
+			return
+		}
+		neighbourhoodQuery.AsOf = &parsed
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = "cytoscape"
+	}
+	if format != "cytoscape" && format != "d3" && format != "dot" {
+		http.Error(w, "format must be cytoscape, d3 or dot", http.StatusBadRequest)
+		return
+	}
+
+	subgraph, err := graph.Users.Neighbourhood(r.Context(), root, neighbourhoodQuery)
+	if err != nil {
+		writeExportError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if subgraph.Truncated {
+		w.Header().Set(truncatedHeader, "true")
+	}
+
+	switch format {
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		_, _ = w.Write([]byte(dotExport(root, subgraph)))
+	case "d3":
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(d3Export(subgraph))
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(cytoscapeExport(subgraph))
+	}
+}
+
+/* Maps a failed neighbourhood read to a status, only client errors are explained */
+func writeExportError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErr *database.ValidationError
+
+	switch {
+	case errors.Is(err, database.ErrUnscoped) && auth.ForContext(r.Context()) == nil:
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+	case errors.Is(err, database.ErrUnscoped):
+		http.Error(w, "caller is not scoped to an institution", http.StatusForbidden)
+	case errors.As(err, &validationErr):
+		http.Error(w, validationErr.Message, http.StatusBadRequest)
+	case errors.Is(err, database.ErrNotFound):
+		http.Error(w, "user not found", http.StatusNotFound)
+	case errors.Is(err, database.ErrUnavailable):
+		http.Error(w, "service temporarily unavailable, try again later", http.StatusServiceUnavailable)
+	default:
+		logging.FromContext(r.Context()).WithError(err).Error("graph export failed")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+func colourOf(node map[string]string) string {
+	if colour, ok := userTypeColours[model.UserType(node["userType"])]; ok {
+		return colour
+	}
+	return defaultColour
+}
+
+/* Edges are identified by type, endpoints and start, each period of a relationship is an edge of its own */
+func edgeId(edge database.EdgeRecord) string {
+	id := edge.FromNode["uuid"] + "-" + edge.Type + "-" + edge.ToNode["uuid"]
+	if edge.Since != nil {
+		id += "-" + edge.Since.UTC().Format(time.RFC3339Nano)
+	}
+	return id
+}
+
+func edgeData(edge database.EdgeRecord) map[string]interface{} {
+	data := map[string]interface{}{"type": edge.Type}
+	if edge.Since != nil {
+		data["since"] = edge.Since.Format(time.RFC3339)
+	}
+	if edge.Until != nil {
+		data["until"] = edge.Until.Format(time.RFC3339)
+	}
+	if edge.Role != "" {
+		data["role"] = edge.Role
+	}
+	if edge.Weight != nil {
+		data["weight"] = *edge.Weight
+	}
+	return data
+}
+
+func cytoscapeExport(subgraph *database.Subgraph) []cytoscapeElement {
+	elements := make([]cytoscapeElement, 0, len(subgraph.Nodes)+len(subgraph.Edges))
+
+	for _, node := range subgraph.Nodes {
+		elements = append(elements, cytoscapeElement{
+			Group: "nodes",
+			Data: map[string]interface{}{
+				"id":       node["uuid"],
+				"label":    node["name"],
+				"userType": node["userType"],
+				"color":    colourOf(node),
+			},
+			Classes: strings.ToLower(node["userType"]),
+		})
+	}
+
+	for _, edge := range subgraph.Edges {
+		data := edgeData(edge)
+		data["id"] = edgeId(edge)
+		data["source"] = edge.FromNode["uuid"]
+		data["target"] = edge.ToNode["uuid"]
+		data["label"] = edge.Type
+		elements = append(elements, cytoscapeElement{Group: "edges", Data: data, Classes: strings.ToLower(edge.Type)})
+	}
+
+	return elements
+}
+
+func d3Export(subgraph *database.Subgraph) d3Graph {
+	export := d3Graph{
+		Nodes:     make([]map[string]interface{}, 0, len(subgraph.Nodes)),
+		Links:     make([]map[string]interface{}, 0, len(subgraph.Edges)),
+		Truncated: subgraph.Truncated,
+	}
+
+	for _, node := range subgraph.Nodes {
+		export.Nodes = append(export.Nodes, map[string]interface{}{
+			"id":    node["uuid"],
+			"name":  node["name"],
+			"group": node["userType"],
+			"color": colourOf(node),
+		})
+	}
+
+	for _, edge := range subgraph.Edges {
+		link := edgeData(edge)
+		link["source"] = edge.FromNode["uuid"]
+		link["target"] = edge.ToNode["uuid"]
+		export.Links = append(export.Links, link)
+	}
+
+	return export
+}
+
+func dotExport(root string, subgraph *database.Subgraph) string {
+	var dot strings.Builder
+
+	dot.WriteString("digraph neighbourhood {\n")
+	dot.WriteString("  node [shape=ellipse, style=filled, fontname=\"Helvetica\"];\n")
+	dot.WriteString("  edge [fontname=\"Helvetica\", fontsize=10];\n")
+	if subgraph.Truncated {
+		dot.WriteString("  label=\"truncated\";\n")
+	}
+
+	for _, node := range subgraph.Nodes {
+		attributes := fmt.Sprintf("label=%s, fillcolor=%s, tooltip=%s",
+			dotQuote(node["name"]), dotQuote(colourOf(node)), dotQuote(node["userType"]))
+		if node["uuid"] == root {
+			attributes += ", penwidth=3"
+		}
+		dot.WriteString(fmt.Sprintf("  %s [%s];\n", dotQuote(node["uuid"]), attributes))
+	}
+
+	for _, edge := range subgraph.Edges {
+		label := edge.Type
+		if edge.Role != "" {
+			label += "\n" + edge.Role
+		}
+		dot.WriteString(fmt.Sprintf("  %s -> %s [label=%s];\n", dotQuote(edge.FromNode["uuid"]), dotQuote(edge.ToNode["uuid"]), dotQuote(label)))
+	}
+
+	dot.WriteString("}\n")
+	return dot.String()
+}
+
+/* Quotes a DOT identifier, escaping backslashes, quotes and newlines */
+func dotQuote(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(value) + `"`
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gql/database"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* A tutor with two students, one of them only since January */
+func testSubgraph() *database.Subgraph {
+	tutor := map[string]string{"uuid": "t1", "name": "Grace \"G\" Hopper", "userType": "TUTOR"}
+	ada := map[string]string{"uuid": "s1", "name": "Ada", "userType": "STUDENT"}
+	alan := map[string]string{"uuid": "s2", "name": "Alan", "userType": "UNKNOWN"}
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	weight := 0.5
+
+	return &database.Subgraph{
+		Nodes: []map[string]string{tutor, ada, alan},
+		Edges: []database.EdgeRecord{
+			{Edge: database.Edge{Type: "TUTORS", Role: "maths"}, FromNode: tutor, ToNode: ada},
+			{Edge: database.Edge{Type: "TUTORS", Since: &since, Weight: &weight}, FromNode: tutor, ToNode: alan},
+		},
+	}
+}
+
+func TestCytoscapeExport(t *testing.T) {
+	elements := cytoscapeExport(testSubgraph())
+
+	if len(elements) != 5 {
+		t.Fatalf("got %d elements, want 5", len(elements))
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"node group", elements[0].Group, "nodes"},
+		{"node id", elements[0].Data["id"], "t1"},
+		{"node colour", elements[0].Data["color"], userTypeColours["TUTOR"]},
+		{"node class", elements[0].Classes, "tutor"},
+		{"unknown type colour", elements[2].Data["color"], defaultColour},
+		{"edge group", elements[3].Group, "edges"},
+		{"edge source", elements[3].Data["source"], "t1"},
+		{"edge target", elements[3].Data["target"], "s1"},
+		{"edge role", elements[3].Data["role"], "maths"},
+		{"edge since", elements[4].Data["since"], "2024-01-01T00:00:00Z"},
+		{"edge weight", elements[4].Data["weight"], 0.5},
+		{"edge class", elements[4].Classes, "tutors"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+
+	if elements[3].Data["id"] == elements[4].Data["id"] {
+		t.Errorf("two edges share the id %v", elements[3].Data["id"])
+	}
+}
+
+func TestD3Export(t *testing.T) {
+	subgraph := testSubgraph()
+	subgraph.Truncated = true
+
+	encoded, err := json.Marshal(d3Export(subgraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		Nodes []struct {
+			ID    string `json:"id"`
+			Group string `json:"group"`
+		} `json:"nodes"`
+		Links []struct {
+			Source string `json:"source"`
+			Target string `json:"target"`
+			Type   string `json:"type"`
+		} `json:"links"`
+		Truncated bool `json:"truncated"`
+	}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded.Nodes) != 3 || decoded.Nodes[1].ID != "s1" || decoded.Nodes[1].Group != "STUDENT" {
+		t.Errorf("nodes = %+v", decoded.Nodes)
+	}
+	if len(decoded.Links) != 2 || decoded.Links[0].Source != "t1" || decoded.Links[0].Target != "s1" || decoded.Links[0].Type != "TUTORS" {
+		t.Errorf("links = %+v", decoded.Links)
+	}
+	if !decoded.Truncated {
+		t.Error("truncated was not exported")
+	}
+
+	// An empty neighbourhood still has lists for the front-end to iterate
+	if encoded, _ := json.Marshal(d3Export(&database.Subgraph{})); !strings.Contains(string(encoded), `"nodes":[]`) {
+		t.Errorf("empty export = %s", encoded)
+	}
+}
+
+func TestDotExport(t *testing.T) {
+	dot := dotExport("t1", testSubgraph())
+
+	for _, want := range []string{
+		"digraph neighbourhood {\n",
+		`"t1" [label="Grace \"G\" Hopper", fillcolor="#33a02c", tooltip="TUTOR", penwidth=3];`,
+		`"s1" [label="Ada", fillcolor="#ff7f00", tooltip="STUDENT"];`,
+		`"t1" -> "s1" [label="TUTORS\nmaths"];`,
+		`"t1" -> "s2" [label="TUTORS"];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT output does not contain %s\n%s", want, dot)
+		}
+	}
+	if strings.Contains(dot, "truncated") {
+		t.Error("a complete neighbourhood was labelled truncated")
+	}
+}
+
+func TestDotQuote(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"plain", `"plain"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`back\slash`, `"back\\slash"`},
+		{"two\nlines", `"two\nlines"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := dotQuote(tt.value); got != tt.want {
+				t.Errorf("dotQuote() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphExportHandlerRejectsBadRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   int
+	}{
+		{"post", http.MethodPost, "/graph?root=t1", http.StatusMethodNotAllowed},
+		{"no root", http.MethodGet, "/graph", http.StatusBadRequest},
+		{"depth not a number", http.MethodGet, "/graph?root=t1&depth=two", http.StatusBadRequest},
+		{"bad asOf", http.MethodGet, "/graph?root=t1&asOf=yesterday", http.StatusBadRequest},
+		{"unknown format", http.MethodGet, "/graph?root=t1&format=svg", http.StatusBadRequest},
+		{"anonymous caller", http.MethodGet, "/graph?root=t1", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			graphExportHandler(recorder, httptest.NewRequest(tt.method, tt.url, nil))
+			if recorder.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", recorder.Code, tt.want, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWriteExportError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"validation", &database.ValidationError{Message: "depth must be between 1 and 3"}, http.StatusBadRequest},
+		{"not found", fmt.Errorf("neighbourhood: %w", database.ErrNotFound), http.StatusNotFound},
+		{"unavailable", database.ErrUnavailable, http.StatusServiceUnavailable},
+		{"unscoped", database.ErrUnscoped, http.StatusUnauthorized},
+		{"other", errors.New("boom"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			writeExportError(recorder, httptest.NewRequest(http.MethodGet, "/graph", nil), tt.err)
+			if recorder.Code != tt.want {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.want)
+			}
+			if tt.want == http.StatusInternalServerError && strings.Contains(recorder.Body.String(), "boom") {
+				t.Error("an internal error was shown to the client")
+			}
+		})
+	}
+}
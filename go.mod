@@ -5,7 +5,19 @@ go 1.16
 require (
 	github.com/99designs/gqlgen v0.16.0
 	github.com/gofrs/uuid v4.2.0+incompatible
+	github.com/gorilla/websocket v1.4.2
+	github.com/mitchellh/mapstructure v1.4.3
 	github.com/neo4j/neo4j-go-driver/v4 v4.4.1
+	github.com/prometheus/client_golang v1.11.0
+	github.com/rs/cors v1.8.2
+	github.com/sirupsen/logrus v1.8.1
+	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.10.1
 	github.com/vektah/gqlparser/v2 v2.2.0
+	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.28.0
+	go.opentelemetry.io/otel v1.3.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.3.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.3.0
+	go.opentelemetry.io/otel/sdk v1.3.0
+	go.opentelemetry.io/otel/trace v1.3.0
 )
@@ -0,0 +1,42 @@
+package graph
+
+import (
+	"context"
+	"gql/database"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// Bookmarks adds the request's latest Neo4j bookmarks to the response extensions,
+// for clients that cannot read response headers
+type Bookmarks struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.ResponseInterceptor
+} = Bookmarks{}
+
+func (b Bookmarks) ExtensionName() string {
+	return "Bookmarks"
+}
+
+func (b Bookmarks) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (b Bookmarks) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	response := next(ctx)
+
+	if response == nil {
+		return response
+	}
+
+	if bookmarks := database.Bookmarks(ctx); len(bookmarks) > 0 {
+		if response.Extensions == nil {
+			response.Extensions = map[string]interface{}{}
+		}
+		response.Extensions["bookmarks"] = bookmarks
+	}
+
+	return response
+}
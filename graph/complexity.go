@@ -0,0 +1,60 @@
+package graph
+
+import (
+	"gql/database"
+	"gql/graph/generated"
+	"gql/graph/model"
+	"time"
+)
+
+// DefaultListSize is the number of items a list field is assumed to return when the client does not supply first
+const DefaultListSize = 100
+
+// GraphAnalyticsComplexity is the fixed cost of graphAnalytics, which loads every user and relationship
+// of the institution into memory however little of the result is selected
+const GraphAnalyticsComplexity = 500
+
+// NewComplexityRoot returns the per field complexity functions used when scoring an operation.
+// List fields are weighted by the number of items requested so nested lists grow multiplicatively.
+func NewComplexityRoot() generated.ComplexityRoot {
+	var c generated.ComplexityRoot
+
+	c.Query.Users = func(childComplexity int, userType model.UserType, first *int, orderBy []*model.UserOrder) int {
+		return listComplexity(childComplexity, first)
+	}
+
+	c.User.Relationships = func(childComplexity int, direction *model.Direction, types []string, asOf *time.Time, first *int) int {
+		return listComplexity(childComplexity, first)
+	}
+
+	c.User.SuggestedPeers = func(childComplexity int, limit *int) int {
+		return listComplexity(childComplexity, limit)
+	}
+
+	// Assume ten neighbours a hop, up to the node cap
+	c.User.Neighbourhood = func(childComplexity int, depth *int, types []string, asOf *time.Time) int {
+		size := 10
+		for hop := 1; depth != nil && hop < *depth && size < database.MaxNeighbourhoodNodes; hop++ {
+			size *= 10
+		}
+		if size > database.MaxNeighbourhoodNodes {
+			size = database.MaxNeighbourhoodNodes
+		}
+		return listComplexity(childComplexity, &size)
+	}
+
+	c.Query.GraphAnalytics = func(childComplexity int, types []string, top *int, refresh *bool) int {
+		return GraphAnalyticsComplexity + childComplexity
+	}
+
+	return c
+}
+
+// listComplexity scores a list field as the cost of one item multiplied by the page size
+func listComplexity(childComplexity int, first *int) int {
+	size := DefaultListSize
+	if first != nil && *first > 0 {
+		size = *first
+	}
+	return size * (childComplexity + 1)
+}
@@ -0,0 +1,93 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"gql/database"
+	"gql/logging"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	errInternalCode        = "INTERNAL_SERVER_ERROR"
+	errUnavailableCode     = "UNAVAILABLE"
+	errBadInputCode        = "BAD_USER_INPUT"
+	errInProgressCode      = "REQUEST_IN_PROGRESS"
+	errUnauthenticatedCode = "UNAUTHENTICATED"
+	errForbiddenCode       = "FORBIDDEN"
+)
+
+// NewErrorPresenter returns the error presenter for the server.
+// Errors raised as a gqlerror, a database.ValidationError or a database.ForbiddenError are meant for the client and always shown,
+// any other error is internal (database, driver etc.) and when detailed is false it is logged and replaced
+// with a generic message.
+func NewErrorPresenter(detailed bool) graphql.ErrorPresenterFunc {
+	return func(ctx context.Context, err error) *gqlerror.Error {
+		presented := graphql.DefaultErrorPresenter(ctx, err)
+
+		// The database is down, tell the client to try again later rather than report a failure
+		if errors.Is(err, database.ErrUnavailable) {
+			return &gqlerror.Error{
+				Message:    "service temporarily unavailable, try again later",
+				Path:       presented.Path,
+				Extensions: map[string]interface{}{"code": errUnavailableCode},
+			}
+		}
+
+		// The first attempt of an idempotent request is still running, its retry should try again shortly
+		if errors.Is(err, database.ErrRequestInProgress) {
+			return &gqlerror.Error{
+				Message:    "a request with this idempotency key is in progress, try again shortly",
+				Path:       presented.Path,
+				Extensions: map[string]interface{}{"code": errInProgressCode},
+			}
+		}
+
+		// An anonymous request with authentication on has no scope, every query it makes is refused
+		if errors.Is(err, database.ErrUnscoped) {
+			return &gqlerror.Error{
+				Message:    "authentication required",
+				Path:       presented.Path,
+				Extensions: map[string]interface{}{"code": errUnauthenticatedCode},
+			}
+		}
+
+		// A refused write explains itself to the client
+		var validationErr *database.ValidationError
+		if errors.As(err, &validationErr) {
+			return &gqlerror.Error{
+				Message:    validationErr.Message,
+				Path:       presented.Path,
+				Extensions: map[string]interface{}{"code": errBadInputCode},
+			}
+		}
+
+		var forbiddenErr *database.ForbiddenError
+		if errors.As(err, &forbiddenErr) {
+			return &gqlerror.Error{
+				Message:    forbiddenErr.Message,
+				Path:       presented.Path,
+				Extensions: map[string]interface{}{"code": errForbiddenCode},
+			}
+		}
+
+		if detailed {
+			return presented
+		}
+
+		var clientErr *gqlerror.Error
+		if errors.As(err, &clientErr) && clientErr.Unwrap() == nil {
+			return presented
+		}
+
+		logging.FromContext(ctx).WithError(err).WithField("path", presented.Path.String()).Error("internal error")
+
+		return &gqlerror.Error{
+			Message:    "internal server error",
+			Path:       presented.Path,
+			Extensions: map[string]interface{}{"code": errInternalCode},
+		}
+	}
+}
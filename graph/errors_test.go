@@ -0,0 +1,46 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gql/database"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestErrorPresenter(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		detailed    bool
+		wantCode    string
+		wantMessage string
+	}{
+		{"unavailable", fmt.Errorf("users: %w", database.ErrUnavailable), false, errUnavailableCode, ""},
+		{"in progress", database.ErrRequestInProgress, false, errInProgressCode, ""},
+		{"unscoped", fmt.Errorf("users: %w", database.ErrUnscoped), false, errUnauthenticatedCode, "authentication required"},
+		{"validation", &database.ValidationError{Message: "name is required"}, false, errBadInputCode, "name is required"},
+		{"forbidden", &database.ForbiddenError{Message: "cannot write to institution south"}, false, errForbiddenCode, "cannot write to institution south"},
+		{"internal hidden", errors.New("connection reset"), false, errInternalCode, "internal server error"},
+		{"internal detailed", errors.New("connection reset"), true, "", "connection reset"},
+		{"client error shown", gqlerror.Errorf("first must not be negative"), false, "", "first must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := graphql.WithResponseContext(context.Background(), graphql.DefaultErrorPresenter, graphql.DefaultRecover)
+			got := NewErrorPresenter(tt.detailed)(ctx, tt.err)
+
+			code, _ := got.Extensions["code"].(string)
+			if code != tt.wantCode {
+				t.Errorf("code = %q, want %q", code, tt.wantCode)
+			}
+			if tt.wantMessage != "" && got.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", got.Message, tt.wantMessage)
+			}
+		})
+	}
+}
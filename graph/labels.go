@@ -0,0 +1,52 @@
+package graph
+
+import (
+	"gql/database"
+	"gql/graph/model"
+)
+
+// Users is the repository for User nodes, a new node type only needs a declaration like this one
+var Users = database.MustRegisterLabel(database.Label{
+	Name: "User",
+	Key:  "uuid",
+	Properties: []database.Property{
+		{Name: "uuid", Type: database.PropertyString, Required: true},
+		{Name: "name", Type: database.PropertyString, Required: true},
+		{Name: "userType", Type: database.PropertyString, Required: true, Values: userTypeValues()},
+	},
+})
+
+// userTypeValues lists the UserType enum so the database only stores types the schema knows
+func userTypeValues() []string {
+	values := make([]string, len(model.AllUserType))
+	for index, userType := range model.AllUserType {
+		values[index] = userType.String()
+	}
+	return values
+}
+
+// Relationship types users may have, the catalogue is checked whenever a relationship is created
+var (
+	Tutors = database.MustRegisterRelationshipType(database.RelationshipType{
+		Name: "TUTORS",
+		From: userEndpoint(model.UserTypeTutor),
+		To:   userEndpoint(model.UserTypeStudent),
+	})
+
+	// A student has one personal tutor at a time, a tutor may look after many students
+	PersonalTutor = database.MustRegisterRelationshipType(database.RelationshipType{
+		Name:     "PERSONAL_TUTOR",
+		From:     userEndpoint(model.UserTypeTutor),
+		To:       userEndpoint(model.UserTypeStudent),
+		MaxPerTo: 1,
+	})
+)
+
+// userEndpoint constrains a relationship end to users of the given types
+func userEndpoint(userTypes ...model.UserType) database.Endpoint {
+	values := make([]string, len(userTypes))
+	for index, userType := range userTypes {
+		values[index] = userType.String()
+	}
+	return database.Endpoint{Label: "User", Property: "userType", Values: values}
+}
@@ -0,0 +1,112 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const errDepthLimit = "DEPTH_LIMIT_EXCEEDED"
+
+const depthExtension = "DepthLimit"
+
+// ComplexityLimit wraps the gqlgen complexity extension so a rejected operation reports its score
+// and the limit as error extensions as well as in the message.
+type ComplexityLimit struct {
+	extension.ComplexityLimit
+}
+
+// NewComplexityLimit creates a fixed complexity limit
+func NewComplexityLimit(limit int) *ComplexityLimit {
+	return &ComplexityLimit{ComplexityLimit: *extension.FixedComplexityLimit(limit)}
+}
+
+func (c ComplexityLimit) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	err := c.ComplexityLimit.MutateOperationContext(ctx, rc)
+	if err == nil {
+		return nil
+	}
+
+	if stats, ok := rc.Stats.GetExtension(c.ExtensionName()).(*extension.ComplexityStats); ok {
+		err.Extensions["complexity"] = stats.Complexity
+		err.Extensions["limit"] = stats.ComplexityLimit
+	}
+
+	return err
+}
+
+// DepthLimit rejects operations whose selection sets are nested deeper than Limit.
+// Introspection fields are not counted so the playground can still load the schema.
+type DepthLimit struct {
+	Limit int
+}
+
+var _ interface {
+	graphql.OperationContextMutator
+	graphql.HandlerExtension
+} = &DepthLimit{}
+
+func (d DepthLimit) ExtensionName() string {
+	return depthExtension
+}
+
+func (d *DepthLimit) Validate(schema graphql.ExecutableSchema) error {
+	if d.Limit <= 0 {
+		return fmt.Errorf("DepthLimit limit must be greater than zero")
+	}
+	return nil
+}
+
+func (d DepthLimit) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	op := rc.Doc.Operations.ForName(rc.OperationName)
+	if op == nil {
+		return nil
+	}
+
+	depth := selectionDepth(op.SelectionSet)
+
+	if depth > d.Limit {
+		err := gqlerror.Errorf("operation has depth %d, which exceeds the limit of %d", depth, d.Limit)
+		errcode.Set(err, errDepthLimit)
+		err.Extensions["depth"] = depth
+		err.Extensions["limit"] = d.Limit
+		return err
+	}
+
+	return nil
+}
+
+// selectionDepth returns the deepest level of nested fields in a selection set, fragments do not add a level
+func selectionDepth(selectionSet ast.SelectionSet) int {
+	maxDepth := 0
+
+	for _, selection := range selectionSet {
+		depth := 0
+
+		switch s := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name, "__") {
+				continue
+			}
+			depth = 1 + selectionDepth(s.SelectionSet)
+		case *ast.InlineFragment:
+			depth = selectionDepth(s.SelectionSet)
+		case *ast.FragmentSpread:
+			if s.Definition != nil {
+				depth = selectionDepth(s.Definition.SelectionSet)
+			}
+		}
+
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+	}
+
+	return maxDepth
+}
@@ -0,0 +1,170 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"gql/graph/generated"
+)
+
+// testResponse is the part of a GraphQL response the tests look at
+type testResponse struct {
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// newTestServer serves the schema with the given extensions, requests that get past them are answered
+// without running any resolver so the tests never reach the database
+func newTestServer(extensions ...graphql.HandlerExtension) *handler.Server {
+	srv := handler.New(generated.NewExecutableSchema(generated.Config{
+		Resolvers:  &Resolver{},
+		Complexity: NewComplexityRoot(),
+	}))
+	srv.AddTransport(transport.POST{})
+	for _, extension := range extensions {
+		srv.Use(extension)
+	}
+	srv.AroundOperations(func(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+		return func(ctx context.Context) *graphql.Response {
+			return &graphql.Response{Data: []byte(`{}`)}
+		}
+	})
+	return srv
+}
+
+// post sends a JSON request body and decodes the response
+func post(t *testing.T, srv *handler.Server, body string) testResponse {
+	t.Helper()
+
+	request := httptest.NewRequest("POST", "/query", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	srv.ServeHTTP(recorder, request)
+
+	var response testResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("cannot decode response %q: %v", recorder.Body.String(), err)
+	}
+	return response
+}
+
+// queryBody encodes a query as a request body
+func queryBody(query string) string {
+	body, _ := json.Marshal(map[string]string{"query": query})
+	return string(body)
+}
+
+// errorCodes lists the codes of a response's errors
+func errorCodes(response testResponse) []string {
+	var codes []string
+	for _, err := range response.Errors {
+		if code, ok := err.Extensions["code"].(string); ok {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+func hasCode(response testResponse, code string) bool {
+	for _, got := range errorCodes(response) {
+		if got == code {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDepthLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		query    string
+		rejected bool
+	}{
+		{"at the limit", 2, `{ user(id: "1") { name } }`, false},
+		{"too deep", 1, `{ user(id: "1") { name } }`, true},
+		{"fragments add no level", 2, `{ user(id: "1") { ...name } } fragment name on User { name }`, false},
+		{"too deep through a fragment", 1, `{ user(id: "1") { ...name } } fragment name on User { name }`, true},
+		{"introspection is not counted", 1, `{ __schema { types { fields { type { name } } } } }`, false},
+		{"nested at the limit", 3, `{ user(id: "1") { relationships { type } } }`, false},
+		{"nested too deep", 3, `{ user(id: "1") { relationships { from { name } } } }`, true},
+		{"nested too deep through a fragment", 3, `{ user(id: "1") { ...deep } } fragment deep on User { relationships { to { name } } }`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := post(t, newTestServer(&DepthLimit{Limit: tt.limit}), queryBody(tt.query))
+			if got := hasCode(response, errDepthLimit); got != tt.rejected {
+				t.Errorf("rejected = %v, want %v (errors %v)", got, tt.rejected, response.Errors)
+			}
+		})
+	}
+}
+
+func TestDepthLimitValidate(t *testing.T) {
+	if err := (&DepthLimit{}).Validate(nil); err == nil {
+		t.Error("Validate() accepted a zero limit")
+	}
+}
+
+func TestComplexityLimit(t *testing.T) {
+	srv := newTestServer(NewComplexityLimit(1000))
+
+	tests := []struct {
+		name     string
+		query    string
+		rejected bool
+	}{
+		{"single user", `{ user(id: "1") { name } }`, false},
+		{"small page", `{ users(userType: STUDENT, first: 10) { name } }`, false},
+		{"large page", `{ users(userType: STUDENT, first: 1000) { name } }`, true},
+		{"nested default pages", `{ users(userType: STUDENT) { relationships { type } } }`, true},
+		{"nested small pages", `{ users(userType: STUDENT, first: 5) { relationships(first: 50) { type } } }`, false},
+		{"analytics on top of them", `{ graphAnalytics { userCount } users(userType: STUDENT, first: 5) { relationships(first: 50) { type } } }`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := post(t, srv, queryBody(tt.query))
+			rejected := hasCode(response, "COMPLEXITY_LIMIT_EXCEEDED")
+			if rejected != tt.rejected {
+				t.Fatalf("rejected = %v, want %v (errors %v)", rejected, tt.rejected, response.Errors)
+			}
+			if rejected && (response.Errors[0].Extensions["complexity"] == nil || response.Errors[0].Extensions["limit"] == nil) {
+				t.Errorf("rejection does not report the complexity and limit: %v", response.Errors[0].Extensions)
+			}
+		})
+	}
+}
+
+func TestListComplexity(t *testing.T) {
+	five, zero := 5, 0
+
+	tests := []struct {
+		name  string
+		child int
+		first *int
+		want  int
+	}{
+		{"default page", 1, nil, 2 * DefaultListSize},
+		{"requested page", 1, &five, 10},
+		{"zero uses the default", 0, &zero, DefaultListSize},
+		{"nested child", 9, &five, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listComplexity(tt.child, tt.first); got != tt.want {
+				t.Errorf("listComplexity() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
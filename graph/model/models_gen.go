@@ -6,23 +6,305 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"time"
 )
 
+type CentralityScore struct {
+	User   *User `json:"user"`
+	Degree int   `json:"degree"`
+	// Degree divided by the number of other users, from 0 to 1
+	Centrality float64 `json:"centrality"`
+}
+
+// Measures of the relation graph between the users of an institution
+type GraphAnalytics struct {
+	ComputedAt        time.Time `json:"computedAt"`
+	UserCount         int       `json:"userCount"`
+	RelationshipCount int       `json:"relationshipCount"`
+	// The best connected users, most distinct neighbours first
+	Centrality []*CentralityScore `json:"centrality"`
+	// Groups of users connected to each other through any chain of relationships, largest first
+	Components []*UserGroup `json:"components"`
+	// Densely connected groups found by modularity optimisation (Louvain local moving), largest first
+	Communities []*UserGroup `json:"communities"`
+	// Users without any of the relationships analysed
+	Isolated []*User `json:"isolated"`
+}
+
+type Neighbourhood struct {
+	Users         []*User         `json:"users"`
+	Relationships []*Relationship `json:"relationships"`
+	// Set when the neighbourhood was larger than the cap and only the users closest to the root were returned
+	Truncated bool `json:"truncated"`
+}
+
+// One step of a batch, exactly one field must be set.
+// Relationship ends may be given as $n to use the id of the user written by operation n (counting from 0) of the same batch.
+type Operation struct {
+	UpsertUser *UserInput         `json:"upsertUser"`
+	Relate     *RelationshipInput `json:"relate"`
+	Unrelate   *UnrelateInput     `json:"unrelate"`
+}
+
+// The outcome of the batch operation in the same position, only the field of its kind is set
+type OperationResult struct {
+	User         *User         `json:"user"`
+	Relationship *Relationship `json:"relationship"`
+	Removed      *bool         `json:"removed"`
+}
+
+type PeerSuggestion struct {
+	User *User `json:"user"`
+	// Neighbours the two users have in common
+	CommonNeighbours int `json:"commonNeighbours"`
+	// Jaccard similarity of the two users' neighbours, from 0 to 1
+	Score float64 `json:"score"`
+}
+
+// A relationship to create, or update when one of the type already links the two users at an overlapping time.
+// Relationships valid at other times are kept, so each period of a relationship is a relationship of its own.
+// The type must be catalogued and the users must be of the types it allows, e.g. TUTORS goes from a TUTOR to a STUDENT.
+type RelationshipInput struct {
+	// Upper snake case, e.g. TUTORS
+	Type string `json:"type"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Left out the relationship has always been valid
+	Since *time.Time `json:"since"`
+	// Left out the relationship is still valid
+	Until  *time.Time `json:"until"`
+	Role   *string    `json:"role"`
+	Weight *float64   `json:"weight"`
+}
+
+// Identifies the relationship to remove
+type UnrelateInput struct {
+	Type string `json:"type"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
 type User struct {
 	ID       string   `json:"id"`
 	Name     string   `json:"name"`
 	UserType UserType `json:"userType"`
+	// Institution the user belongs to
+	Institution string `json:"institution"`
+	// Relationships to and from the user, with asOf only those valid at that moment
+	Relationships []*Relationship `json:"relationships"`
+	// Users of the same type sharing the most current neighbours (tutors, groups, ...) that the user isn't related to yet, at most 50
+	SuggestedPeers []*PeerSuggestion `json:"suggestedPeers"`
+	// The users within depth (at most 3) relationships and the relationships between them, at most 250 users
+	Neighbourhood *Neighbourhood `json:"neighbourhood"`
+}
+
+type UserGroup struct {
+	Size  int     `json:"size"`
+	Users []*User `json:"users"`
 }
 
 type UserInput struct {
 	ID       *string  `json:"id"`
 	Name     string   `json:"name"`
 	UserType UserType `json:"userType"`
+	// Only a super admin may choose or change the institution, everyone else works in their own
+	Institution *string `json:"institution"`
+}
+
+// One sort key, earlier keys take precedence and users always finish sorted by id so pages are stable
+type UserOrder struct {
+	Field     UserOrderField `json:"field"`
+	Direction *SortDirection `json:"direction"`
+	// Left out null values follow the database default, last when ascending and first when descending
+	Nulls *NullsOrder `json:"nulls"`
+}
+
+// The state of a user after one write
+type UserVersion struct {
+	Version    int       `json:"version"`
+	RecordedAt time.Time `json:"recordedAt"`
+	// Set on the version recorded when the user was deleted, user is then their last state
+	Deleted bool  `json:"deleted"`
+	User    *User `json:"user"`
+}
+
+type Direction string
+
+const (
+	DirectionOutgoing Direction = "OUTGOING"
+	DirectionIncoming Direction = "INCOMING"
+	DirectionBoth     Direction = "BOTH"
+)
+
+var AllDirection = []Direction{
+	DirectionOutgoing,
+	DirectionIncoming,
+	DirectionBoth,
+}
+
+func (e Direction) IsValid() bool {
+	switch e {
+	case DirectionOutgoing, DirectionIncoming, DirectionBoth:
+		return true
+	}
+	return false
+}
+
+func (e Direction) String() string {
+	return string(e)
+}
+
+func (e *Direction) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Direction(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Direction", str)
+	}
+	return nil
+}
+
+func (e Direction) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// Where users without a value for the sort property appear
+type NullsOrder string
+
+const (
+	NullsOrderFirst NullsOrder = "FIRST"
+	NullsOrderLast  NullsOrder = "LAST"
+)
+
+var AllNullsOrder = []NullsOrder{
+	NullsOrderFirst,
+	NullsOrderLast,
+}
+
+func (e NullsOrder) IsValid() bool {
+	switch e {
+	case NullsOrderFirst, NullsOrderLast:
+		return true
+	}
+	return false
+}
+
+func (e NullsOrder) String() string {
+	return string(e)
+}
+
+func (e *NullsOrder) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = NullsOrder(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid NullsOrder", str)
+	}
+	return nil
+}
+
+func (e NullsOrder) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SortDirection string
+
+const (
+	SortDirectionAsc  SortDirection = "ASC"
+	SortDirectionDesc SortDirection = "DESC"
+)
+
+var AllSortDirection = []SortDirection{
+	SortDirectionAsc,
+	SortDirectionDesc,
+}
+
+func (e SortDirection) IsValid() bool {
+	switch e {
+	case SortDirectionAsc, SortDirectionDesc:
+		return true
+	}
+	return false
+}
+
+func (e SortDirection) String() string {
+	return string(e)
+}
+
+func (e *SortDirection) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SortDirection(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SortDirection", str)
+	}
+	return nil
+}
+
+func (e SortDirection) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// User property a list of users can be sorted by
+type UserOrderField string
+
+const (
+	UserOrderFieldID          UserOrderField = "ID"
+	UserOrderFieldName        UserOrderField = "NAME"
+	UserOrderFieldUserType    UserOrderField = "USER_TYPE"
+	UserOrderFieldInstitution UserOrderField = "INSTITUTION"
+)
+
+var AllUserOrderField = []UserOrderField{
+	UserOrderFieldID,
+	UserOrderFieldName,
+	UserOrderFieldUserType,
+	UserOrderFieldInstitution,
+}
+
+func (e UserOrderField) IsValid() bool {
+	switch e {
+	case UserOrderFieldID, UserOrderFieldName, UserOrderFieldUserType, UserOrderFieldInstitution:
+		return true
+	}
+	return false
+}
+
+func (e UserOrderField) String() string {
+	return string(e)
+}
+
+func (e *UserOrderField) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UserOrderField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UserOrderField", str)
+	}
+	return nil
+}
+
+func (e UserOrderField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
 type UserType string
 
 const (
+	// Administrator with access to every institution
+	UserTypeSuperAdmin UserType = "SUPER_ADMIN"
 	// Administrator account
 	UserTypeAdmin UserType = "ADMIN"
 	// Tutor account
@@ -40,6 +322,7 @@ const (
 )
 
 var AllUserType = []UserType{
+	UserTypeSuperAdmin,
 	UserTypeAdmin,
 	UserTypeTutor,
 	UserTypeStudent,
@@ -51,7 +334,7 @@ var AllUserType = []UserType{
 
 func (e UserType) IsValid() bool {
 	switch e {
-	case UserTypeAdmin, UserTypeTutor, UserTypeStudent, UserTypeUnvalidated, UserTypeSuspended, UserTypeRetired, UserTypeDelete:
+	case UserTypeSuperAdmin, UserTypeAdmin, UserTypeTutor, UserTypeStudent, UserTypeUnvalidated, UserTypeSuspended, UserTypeRetired, UserTypeDelete:
 		return true
 	}
 	return false
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// Relationship carries both users so from and to resolve without another query
+type Relationship struct {
+	Type   string     `json:"type"`
+	From   *User      `json:"from"`
+	To     *User      `json:"to"`
+	Since  *time.Time `json:"since"`
+	Until  *time.Time `json:"until"`
+	Role   *string    `json:"role"`
+	Weight *float64   `json:"weight"`
+}
@@ -0,0 +1,234 @@
+package graph
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gql/logging"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/mitchellh/mapstructure"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	errPersistedQueryNotFound     = "PersistedQueryNotFound"
+	errPersistedQueryNotFoundCode = "PERSISTED_QUERY_NOT_FOUND"
+	errOperationNotAllowedCode    = "OPERATION_NOT_ALLOWED"
+)
+
+// FileQueryCache is a graphql.Cache that stores persisted queries as files named by their sha256 hash,
+// so registered queries survive a restart and can be shared between instances through a mounted volume.
+// Any client can register a query, so once MaxEntries are stored the oldest are removed to make room.
+type FileQueryCache struct {
+	Dir        string
+	MaxEntries int
+
+	mu sync.Mutex
+}
+
+var _ graphql.Cache = &FileQueryCache{}
+
+// NewFileQueryCache creates the cache directory if required
+func NewFileQueryCache(dir string, maxEntries int) (*FileQueryCache, error) {
+	if maxEntries <= 0 {
+		return nil, fmt.Errorf("persisted query cache size must be greater than zero")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create persisted query directory %s: %w", dir, err)
+	}
+	return &FileQueryCache{Dir: dir, MaxEntries: maxEntries}, nil
+}
+
+func (f *FileQueryCache) Get(ctx context.Context, key string) (interface{}, bool) {
+	// Keys come from the client so only accept a well formed hash as a file name
+	if !isQueryHash(key) {
+		return nil, false
+	}
+
+	query, err := ioutil.ReadFile(filepath.Join(f.Dir, key+".graphql"))
+	if err != nil {
+		return nil, false
+	}
+
+	return string(query), true
+}
+
+func (f *FileQueryCache) Add(ctx context.Context, key string, value interface{}) {
+	query, ok := value.(string)
+	if !ok || !isQueryHash(key) {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Write to a temporary file then rename so readers never see a partial query
+	tmp, err := ioutil.TempFile(f.Dir, key+".*.tmp")
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Warn("cannot store persisted query")
+		return
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err = tmp.WriteString(query); err != nil {
+		_ = tmp.Close()
+		logging.FromContext(ctx).WithError(err).Warn("cannot store persisted query")
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		logging.FromContext(ctx).WithError(err).Warn("cannot store persisted query")
+		return
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(f.Dir, key+".graphql")); err != nil {
+		logging.FromContext(ctx).WithError(err).Warn("cannot store persisted query")
+		return
+	}
+
+	if err = f.evict(); err != nil {
+		logging.FromContext(ctx).WithError(err).Warn("cannot evict persisted queries")
+	}
+}
+
+// evict removes the queries written longest ago until at most MaxEntries are left. Other instances sharing
+// the directory evict as well, so a query may already be gone and that isn't an error.
+func (f *FileQueryCache) evict() error {
+	files, err := ioutil.ReadDir(f.Dir)
+	if err != nil {
+		return err
+	}
+
+	var queries []os.FileInfo
+	for _, file := range files {
+		name := file.Name()
+		if file.Mode().IsRegular() && filepath.Ext(name) == ".graphql" && isQueryHash(strings.TrimSuffix(name, ".graphql")) {
+			queries = append(queries, file)
+		}
+	}
+	if len(queries) <= f.MaxEntries {
+		return nil
+	}
+
+	sort.Slice(queries, func(i, j int) bool {
+		return queries[i].ModTime().Before(queries[j].ModTime())
+	})
+	for _, query := range queries[:len(queries)-f.MaxEntries] {
+		if err := os.Remove(filepath.Join(f.Dir, query.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// AllowList only executes operations whose sha256 hash is listed, it replaces automatic persisted queries
+// in strict mode so clients may send either the full document or just its hash.
+type AllowList struct {
+	queries map[string]string
+}
+
+var _ interface {
+	graphql.OperationParameterMutator
+	graphql.HandlerExtension
+} = AllowList{}
+
+// LoadAllowList reads a JSON object mapping sha256 hashes to query documents, as generated from the client code
+func LoadAllowList(path string) (*AllowList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read operation allow-list: %w", err)
+	}
+
+	queries := make(map[string]string)
+	if err = json.Unmarshal(data, &queries); err != nil {
+		return nil, fmt.Errorf("cannot parse operation allow-list %s: %w", path, err)
+	}
+
+	for hash, query := range queries {
+		if computeQueryHash(query) != hash {
+			return nil, fmt.Errorf("operation allow-list %s: hash %s does not match its query", path, hash)
+		}
+	}
+
+	return &AllowList{queries: queries}, nil
+}
+
+func (a AllowList) ExtensionName() string {
+	return "OperationAllowList"
+}
+
+func (a AllowList) Validate(schema graphql.ExecutableSchema) error {
+	if a.queries == nil {
+		return fmt.Errorf("OperationAllowList must be created with LoadAllowList")
+	}
+	return nil
+}
+
+func (a AllowList) MutateOperationParameters(ctx context.Context, rawParams *graphql.RawParams) *gqlerror.Error {
+	var extension struct {
+		Sha256  string `mapstructure:"sha256Hash"`
+		Version int64  `mapstructure:"version"`
+	}
+
+	if rawParams.Extensions["persistedQuery"] != nil {
+		if err := mapstructure.Decode(rawParams.Extensions["persistedQuery"], &extension); err != nil {
+			return gqlerror.Errorf("invalid APQ extension data")
+		}
+		if extension.Version != 1 {
+			return gqlerror.Errorf("unsupported APQ version")
+		}
+	}
+
+	// Hash only request, look the document up in the allow-list
+	if rawParams.Query == "" {
+		query, ok := a.queries[extension.Sha256]
+		if !ok {
+			err := gqlerror.Errorf(errPersistedQueryNotFound)
+			errcode.Set(err, errPersistedQueryNotFoundCode)
+			return err
+		}
+		rawParams.Query = query
+		return nil
+	}
+
+	hash := computeQueryHash(rawParams.Query)
+	if extension.Sha256 != "" && extension.Sha256 != hash {
+		return gqlerror.Errorf("provided APQ hash does not match query")
+	}
+
+	if _, ok := a.queries[hash]; !ok {
+		err := gqlerror.Errorf("operation %s is not in the allow-list", hash)
+		errcode.Set(err, errOperationNotAllowedCode)
+		return err
+	}
+
+	return nil
+}
+
+func computeQueryHash(query string) string {
+	b := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(b[:])
+}
+
+// isQueryHash reports whether key is a lower case hex encoded sha256 hash
+func isQueryHash(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const allowedQuery = `{ __typename }`
+
+// writeAllowList writes queries keyed by the given hashes and loads them
+func writeAllowList(t *testing.T, queries map[string]string) (*AllowList, error) {
+	t.Helper()
+
+	data, err := json.Marshal(queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "allow-list.json")
+	if err := ioutil.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadAllowList(path)
+}
+
+func TestLoadAllowList(t *testing.T) {
+	if _, err := writeAllowList(t, map[string]string{computeQueryHash(allowedQuery): allowedQuery}); err != nil {
+		t.Errorf("LoadAllowList() error = %v", err)
+	}
+	if _, err := writeAllowList(t, map[string]string{computeQueryHash("{ other }"): allowedQuery}); err == nil {
+		t.Error("LoadAllowList() accepted a hash that doesn't match its query")
+	}
+	if _, err := LoadAllowList(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadAllowList() accepted a missing file")
+	}
+}
+
+func TestAllowList(t *testing.T) {
+	allowList, err := writeAllowList(t, map[string]string{computeQueryHash(allowedQuery): allowedQuery})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(allowList)
+
+	persisted := func(query, hash string) string {
+		body := map[string]interface{}{
+			"extensions": map[string]interface{}{"persistedQuery": map[string]interface{}{"version": 1, "sha256Hash": hash}},
+		}
+		if query != "" {
+			body["query"] = query
+		}
+		encoded, _ := json.Marshal(body)
+		return string(encoded)
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode string
+	}{
+		{"listed document", queryBody(allowedQuery), ""},
+		{"listed hash only", persisted("", computeQueryHash(allowedQuery)), ""},
+		{"listed document and hash", persisted(allowedQuery, computeQueryHash(allowedQuery)), ""},
+		{"unlisted document", queryBody(`{ user(id: "1") { name } }`), errOperationNotAllowedCode},
+		{"unlisted hash", persisted("", computeQueryHash("{ other }")), errPersistedQueryNotFoundCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := post(t, srv, tt.body)
+			if tt.wantCode == "" && len(response.Errors) > 0 {
+				t.Fatalf("unexpected errors %v", response.Errors)
+			}
+			if tt.wantCode != "" && !hasCode(response, tt.wantCode) {
+				t.Fatalf("error codes %v, want %s", errorCodes(response), tt.wantCode)
+			}
+		})
+	}
+
+	response := post(t, srv, persisted(allowedQuery, computeQueryHash("{ other }")))
+	if len(response.Errors) == 0 {
+		t.Error("a hash not matching the document was accepted")
+	}
+}
+
+func TestFileQueryCache(t *testing.T) {
+	cache, err := NewFileQueryCache(filepath.Join(t.TempDir(), "queries"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	hash := computeQueryHash(allowedQuery)
+
+	cache.Add(ctx, hash, allowedQuery)
+	if query, ok := cache.Get(ctx, hash); !ok || query != allowedQuery {
+		t.Errorf("Get() = %v, %v after Add", query, ok)
+	}
+
+	// Keys become file names so anything but a hash is ignored
+	cache.Add(ctx, "../escape", allowedQuery)
+	if _, err := os.Stat(filepath.Join(cache.Dir, "..", "escape.graphql")); !os.IsNotExist(err) {
+		t.Error("Add() wrote outside the cache directory")
+	}
+	if _, ok := cache.Get(ctx, "../escape"); ok {
+		t.Error("Get() accepted a key that isn't a hash")
+	}
+}
+
+func TestFileQueryCacheEviction(t *testing.T) {
+	cache, err := NewFileQueryCache(t.TempDir(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	queries := []string{"{ a }", "{ b }", "{ c }"}
+	start := time.Now().Add(-time.Hour)
+	for index, query := range queries {
+		hash := computeQueryHash(query)
+		cache.Add(ctx, hash, query)
+
+		// Queries written within the same clock tick would be the same age, so age them a minute apart
+		written := start.Add(time.Duration(index) * time.Minute)
+		if err := os.Chtimes(filepath.Join(cache.Dir, hash+".graphql"), written, written); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{queries[0], false},
+		{queries[1], true},
+		{queries[2], true},
+	}
+	for _, tt := range tests {
+		if _, ok := cache.Get(ctx, computeQueryHash(tt.query)); ok != tt.want {
+			t.Errorf("Get(%q) found = %v, want %v", tt.query, ok, tt.want)
+		}
+	}
+
+	if _, err := NewFileQueryCache(t.TempDir(), 0); err == nil {
+		t.Error("NewFileQueryCache() accepted a cache without room for any query")
+	}
+}
@@ -2,8 +2,20 @@ package graph
 
 //go:generate go run github.com/99designs/gqlgen generate
 import (
+	"context"
+	"errors"
+	"fmt"
+	"gql/analytics"
+	"gql/auth"
 	"gql/database"
 	"gql/graph/model"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
 // This file will not be regenerated automatically.
@@ -11,16 +23,55 @@ import (
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct {
+	Analytics *analytics.Cache
+}
+
+// SaveUser inserts the user from input, or updates it when input has an id
+func (r Resolver) SaveUser(ctx context.Context, input model.UserInput) (*model.User, error) {
+	// Super admins can see every institution so only they may create more
+	if input.UserType == model.UserTypeSuperAdmin && !auth.ForContext(ctx).IsSuperAdmin() {
+		return nil, gqlerror.Errorf("only a super admin may create a super admin")
+	}
+
+	// Update or insert defined by the presence of an user ID value?
+	var userId string
+
+	if input.ID != nil {
+		userId = *input.ID
+	} else {
+		newUuid, err := uuid.NewV4() // Create a Version 4 UUID.
+		if err != nil {
+			return nil, fmt.Errorf("UUID creation error %v", err)
+		}
+		userId = newUuid.String()
+	}
+
+	user := model.User{
+		ID:       userId,
+		Name:     input.Name,
+		UserType: input.UserType}
+
+	if input.Institution != nil {
+		user.Institution = *input.Institution
+	}
+
+	result, err := r.UpdateInsertUser(ctx, user)
+
+	return result, err
 }
 
 // UpdateInsertUser Convert model a map then call the db method to update or insert a user
-func (r Resolver) UpdateInsertUser(insertionData model.User) (*model.User, error) {
+func (r Resolver) UpdateInsertUser(ctx context.Context, insertionData model.User) (*model.User, error) {
 
 	// Unpack data for the database model to map
 	userData := map[string]string{"uuid": insertionData.ID, "name": insertionData.Name, "userType": insertionData.UserType.String()}
 
-	result, databaseErr := database.UpdateInsertQuery(database.SearchNode{NodeName: "User", SearchKey: "uuid", SearchValue: insertionData.ID},
-		userData)
+	// Left out the database uses the caller's institution
+	if insertionData.Institution != "" {
+		userData["institution"] = insertionData.Institution
+	}
+
+	result, databaseErr := Users.Save(ctx, userData)
 
 	// Database error returned
 	if databaseErr != nil {
@@ -28,48 +79,41 @@ func (r Resolver) UpdateInsertUser(insertionData model.User) (*model.User, error
 	}
 
 	// Return the node created/updated data
-	return &model.User{
-		ID:       result["uuid"],
-		Name:     result["name"],
-		UserType: model.UserType(result["userType"]),
-	}, nil
+	return userFromNode(result), nil
 
 }
 
-func (r Resolver) QueryUser(userData model.User) (*model.User, error) {
+func (r Resolver) QueryUser(ctx context.Context, userData model.User, asOf *time.Time) (*model.User, error) {
 
-	returnParams := []string{"uuid", "name", "userType"}
+	var result map[string]string
+	var databaseErr error
 
-	result, databaseErr := database.SimpleQuery(database.SearchNode{
-		NodeName:    "User",
-		SearchKey:   "uuid",
-		SearchValue: userData.ID,
-	}, returnParams)
+	// A point in time read comes from the user's history
+	if asOf != nil {
+		result, databaseErr = Users.AsOf(ctx, userData.ID, *asOf)
+	} else {
+		result, databaseErr = Users.Get(ctx, userData.ID)
+	}
+
+	// No such user in the caller's institution
+	if errors.Is(databaseErr, database.ErrNotFound) {
+		return nil, gqlerror.Errorf("user %s not found", userData.ID)
+	}
 
 	// Database error returned
 	if databaseErr != nil {
 		return nil, databaseErr
 	}
 
-	// Return the node created/updated data
-	return &model.User{
-		ID:       result["uuid"],
-		Name:     result["name"],
-		UserType: model.UserType(result["userType"]),
-	}, nil
+	return userFromNode(result), nil
 
 }
 
-func (r Resolver) QueryUsers(userData model.User) ([]*model.User, error) {
+func (r Resolver) QueryUsers(ctx context.Context, userData model.User, limit int64, orderBy []*model.UserOrder) ([]*model.User, error) {
 
 	searchParameters := map[string]string{"userType": userData.UserType.String()}
-	resultPtr, databaseErr := database.NodeQuery(database.MultiParamSearchNode{
-		NodeName:     "User",
-		SearchParams: searchParameters,
-		SearchLimit:  0,
-		Ordering:     nil,
-		Descending:   false,
-	})
+	results, databaseErr := Users.List(ctx, searchParameters, limit, userSortFields(orderBy))
+
 	// Database error returned
 	if databaseErr != nil {
 		return nil, databaseErr
@@ -77,17 +121,411 @@ func (r Resolver) QueryUsers(userData model.User) ([]*model.User, error) {
 
 	var u []*model.User
 
-	//var u []model.User
-
-	for _, currentData := range *resultPtr {
+	for _, currentData := range results {
 		// change map to users
-		u = append(u, &model.User{
-			ID:       currentData["uuid"],
-			Name:     currentData["name"],
-			UserType: model.UserType(currentData["userType"]),
-		})
+		u = append(u, userFromNode(currentData))
 	}
 
 	return u, nil
 
 }
+
+// QueryUserHistory reads every recorded version of a user
+func (r Resolver) QueryUserHistory(ctx context.Context, userData model.User) ([]*model.UserVersion, error) {
+
+	results, databaseErr := Users.History(ctx, userData.ID)
+
+	// Database error returned
+	if databaseErr != nil {
+		return nil, databaseErr
+	}
+
+	versions := make([]*model.UserVersion, len(results))
+	for index, result := range results {
+		versions[index] = &model.UserVersion{
+			Version:    int(result.Version),
+			RecordedAt: result.RecordedAt,
+			Deleted:    result.Deleted,
+			User:       userFromNode(result.Properties),
+		}
+	}
+
+	return versions, nil
+
+}
+
+// RevertUserVersion restores a user to an earlier version
+func (r Resolver) RevertUserVersion(ctx context.Context, userData model.User, version int) (*model.User, error) {
+
+	result, databaseErr := Users.Revert(ctx, userData.ID, int64(version))
+
+	// The user has been deleted or isn't in the caller's institution
+	if errors.Is(databaseErr, database.ErrNotFound) {
+		return nil, gqlerror.Errorf("user %s not found", userData.ID)
+	}
+
+	// Database error returned
+	if databaseErr != nil {
+		return nil, databaseErr
+	}
+
+	return userFromNode(result), nil
+
+}
+
+// RelateUsers creates or updates a relationship between two users of the caller's institution
+func (r Resolver) RelateUsers(ctx context.Context, edge database.Edge) (*model.Relationship, error) {
+
+	result, databaseErr := Users.Relate(ctx, Users, edge)
+
+	// One of the users isn't in the caller's institution
+	if errors.Is(databaseErr, database.ErrNotFound) {
+		return nil, gqlerror.Errorf("users %s and %s not found", edge.From, edge.To)
+	}
+
+	// Database error returned
+	if databaseErr != nil {
+		return nil, databaseErr
+	}
+
+	return relationshipFromEdge(*result), nil
+
+}
+
+// QueryRelationships reads the relationships around a user
+func (r Resolver) QueryRelationships(ctx context.Context, userData model.User, edgeQuery database.EdgeQuery) ([]*model.Relationship, error) {
+
+	results, databaseErr := Users.Edges(ctx, userData.ID, edgeQuery)
+
+	// Database error returned
+	if databaseErr != nil {
+		return nil, databaseErr
+	}
+
+	relationships := make([]*model.Relationship, len(results))
+	for index, result := range results {
+		relationships[index] = relationshipFromEdge(result)
+	}
+
+	return relationships, nil
+
+}
+
+// QuerySuggestedPeers recommends users of the same type as userData who share neighbours with them
+func (r Resolver) QuerySuggestedPeers(ctx context.Context, userData model.User, limit int) ([]*model.PeerSuggestion, error) {
+
+	results, databaseErr := Users.SuggestPeers(ctx, userData.ID, database.PeerQuery{SameProperty: "userType", Limit: limit})
+
+	// Database error returned
+	if databaseErr != nil {
+		return nil, databaseErr
+	}
+
+	suggestions := make([]*model.PeerSuggestion, len(results))
+	for index, result := range results {
+		suggestions[index] = &model.PeerSuggestion{
+			User:             userFromNode(result.Node),
+			CommonNeighbours: int(result.Common),
+			Score:            result.Score,
+		}
+	}
+
+	return suggestions, nil
+
+}
+
+// QueryNeighbourhood reads the subgraph around a user
+func (r Resolver) QueryNeighbourhood(ctx context.Context, userData model.User, neighbourhoodQuery database.NeighbourhoodQuery) (*model.Neighbourhood, error) {
+
+	result, databaseErr := Users.Neighbourhood(ctx, userData.ID, neighbourhoodQuery)
+
+	// Database error returned
+	if databaseErr != nil {
+		return nil, databaseErr
+	}
+
+	neighbourhood := &model.Neighbourhood{
+		Users:         make([]*model.User, len(result.Nodes)),
+		Relationships: make([]*model.Relationship, len(result.Edges)),
+		Truncated:     result.Truncated,
+	}
+	for index, node := range result.Nodes {
+		neighbourhood.Users[index] = userFromNode(node)
+	}
+	for index, edge := range result.Edges {
+		neighbourhood.Relationships[index] = relationshipFromEdge(edge)
+	}
+
+	return neighbourhood, nil
+
+}
+
+// QueryGraphAnalytics analyses the relationships of the given types between the users the caller can see,
+// reusing the cached report unless refresh is set
+func (r Resolver) QueryGraphAnalytics(ctx context.Context, types []string, top int, refresh bool) (*model.GraphAnalytics, error) {
+
+	compute := func() (*analytics.Report, error) {
+		now := time.Now()
+		snapshot, databaseErr := Users.Snapshot(ctx, database.SnapshotQuery{Types: types, AsOf: &now})
+
+		// Database error returned
+		if databaseErr != nil {
+			return nil, databaseErr
+		}
+
+		return analytics.Analyse(graphFromSnapshot(snapshot)), nil
+	}
+
+	var report *analytics.Report
+	var err error
+	if r.Analytics != nil {
+		report, err = r.Analytics.Get(analyticsKey(ctx, types), refresh, compute)
+	} else {
+		report, err = compute()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user := func(id string) *model.User {
+		return userFromNode(report.Properties[id])
+	}
+	groups := func(ids [][]string) []*model.UserGroup {
+		result := make([]*model.UserGroup, len(ids))
+		for index, group := range ids {
+			result[index] = &model.UserGroup{Size: len(group)}
+			for _, id := range group {
+				result[index].Users = append(result[index].Users, user(id))
+			}
+		}
+		return result
+	}
+
+	result := &model.GraphAnalytics{
+		ComputedAt:        report.ComputedAt,
+		UserCount:         report.NodeCount,
+		RelationshipCount: report.EdgeCount,
+		Components:        groups(report.Components),
+		Communities:       groups(report.Communities),
+		Isolated:          []*model.User{},
+		Centrality:        []*model.CentralityScore{},
+	}
+	for index, score := range report.Centrality {
+		if index >= top {
+			break
+		}
+		result.Centrality = append(result.Centrality, &model.CentralityScore{User: user(score.Node), Degree: score.Degree, Centrality: score.Centrality})
+	}
+	for _, id := range report.Isolated {
+		result.Isolated = append(result.Isolated, user(id))
+	}
+
+	return result, nil
+
+}
+
+// graphFromSnapshot converts the users and relationships loaded from the database to the analytics graph
+func graphFromSnapshot(snapshot *database.Subgraph) *analytics.Graph {
+	graph := &analytics.Graph{Properties: make(map[string]map[string]string, len(snapshot.Nodes))}
+
+	for _, node := range snapshot.Nodes {
+		graph.Nodes = append(graph.Nodes, node["uuid"])
+		graph.Properties[node["uuid"]] = node
+	}
+	for _, edge := range snapshot.Edges {
+		graph.Edges = append(graph.Edges, analytics.Edge{From: edge.FromNode["uuid"], To: edge.ToNode["uuid"], Type: edge.Type})
+	}
+
+	return graph
+}
+
+// analyticsKey caches reports per institution and set of relationship types
+func analyticsKey(ctx context.Context, types []string) string {
+	institution := "*"
+	if caller := auth.ForContext(ctx); caller != nil && !caller.IsSuperAdmin() {
+		institution = caller.Institution
+	}
+
+	sorted := append([]string(nil), types...)
+	sort.Strings(sorted)
+
+	return institution + "|" + strings.Join(sorted, ",")
+}
+
+// relationshipFromEdge converts an edge read from the database to the model
+func relationshipFromEdge(edge database.EdgeRecord) *model.Relationship {
+	relationship := &model.Relationship{
+		Type:   edge.Type,
+		From:   userFromNode(edge.FromNode),
+		To:     userFromNode(edge.ToNode),
+		Since:  edge.Since,
+		Until:  edge.Until,
+		Weight: edge.Weight,
+	}
+	if edge.Role != "" {
+		relationship.Role = &edge.Role
+	}
+	return relationship
+}
+
+// MaxBatchOperations caps the operations of one batch mutation, they all share a transaction
+const MaxBatchOperations = 100
+
+// applyOperation runs one operation of a batch, userIds are the users written by the operations before it
+func (r *mutationResolver) applyOperation(ctx context.Context, operation *model.Operation, userIds []string) (*model.OperationResult, error) {
+	set := 0
+	for _, present := range []bool{operation.UpsertUser != nil, operation.Relate != nil, operation.Unrelate != nil} {
+		if present {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, gqlerror.Errorf("exactly one of upsertUser, relate or unrelate must be set")
+	}
+
+	switch {
+	case operation.UpsertUser != nil:
+		user, err := r.SaveUser(ctx, *operation.UpsertUser)
+		if err != nil {
+			return nil, err
+		}
+		return &model.OperationResult{User: user}, nil
+
+	case operation.Relate != nil:
+		input := *operation.Relate
+		var err error
+		if input.From, err = batchReference(input.From, userIds); err != nil {
+			return nil, err
+		}
+		if input.To, err = batchReference(input.To, userIds); err != nil {
+			return nil, err
+		}
+		relationship, err := r.Relate(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		return &model.OperationResult{Relationship: relationship}, nil
+
+	default:
+		input := *operation.Unrelate
+		var err error
+		if input.From, err = batchReference(input.From, userIds); err != nil {
+			return nil, err
+		}
+		if input.To, err = batchReference(input.To, userIds); err != nil {
+			return nil, err
+		}
+		removed, err := r.Unrelate(ctx, input.Type, input.From, input.To)
+		if err != nil {
+			return nil, err
+		}
+		return &model.OperationResult{Removed: &removed}, nil
+	}
+}
+
+// maxIdempotencyKeyLength caps the keys clients may send
+const maxIdempotencyKeyLength = 255
+
+// idempotent runs write once per idempotency key, the mutation's argument taking priority over the request's
+// header, and without a key simply runs it. Keys are kept apart per mutation and caller so nobody is given
+// the response to someone else's request.
+func idempotent(ctx context.Context, mutation string, argument *string, request, response interface{}, write func(ctx context.Context) error) error {
+	key := database.IdempotencyKey(ctx)
+	if argument != nil {
+		key = *argument
+	}
+
+	if key == "" {
+		return write(ctx)
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		return gqlerror.Errorf("an idempotency key may be at most %d characters", maxIdempotencyKeyLength)
+	}
+
+	var callerId string
+	if caller := auth.ForContext(ctx); caller != nil {
+		callerId = caller.ID
+	}
+
+	return database.Idempotent(ctx, mutation+"/"+callerId+"/"+key, request, response, write)
+}
+
+// batchReference resolves $n to the id of the user written by operation n, any other id is returned as it is
+func batchReference(id string, userIds []string) (string, error) {
+	if !strings.HasPrefix(id, "$") {
+		return id, nil
+	}
+
+	index, err := strconv.Atoi(strings.TrimPrefix(id, "$"))
+	if err != nil || index < 0 || index >= len(userIds) || userIds[index] == "" {
+		return "", gqlerror.Errorf("%s does not refer to a user written by an earlier operation", id)
+	}
+
+	return userIds[index], nil
+}
+
+// operationError says which operation of a batch failed while keeping how the error is presented
+func operationError(index int, err error) error {
+	var clientErr *gqlerror.Error
+	if errors.As(err, &clientErr) && clientErr.Unwrap() == nil {
+		return gqlerror.Errorf("operation %d: %s", index, clientErr.Message)
+	}
+
+	var validationErr *database.ValidationError
+	if errors.As(err, &validationErr) {
+		return &database.ValidationError{Message: fmt.Sprintf("operation %d: %s", index, validationErr.Message)}
+	}
+
+	return fmt.Errorf("operation %d: %w", index, err)
+}
+
+// userFromNode converts the properties of a User node to the model
+func userFromNode(node map[string]string) *model.User {
+	return &model.User{
+		ID:          node["uuid"],
+		Name:        node["name"],
+		UserType:    model.UserType(node["userType"]),
+		Institution: node["institution"],
+	}
+}
+
+// userOrderProperties maps the sortable fields of the schema to the node properties holding them
+var userOrderProperties = map[model.UserOrderField]string{
+	model.UserOrderFieldID:          "uuid",
+	model.UserOrderFieldName:        "name",
+	model.UserOrderFieldUserType:    "userType",
+	model.UserOrderFieldInstitution: "institution",
+}
+
+// userSortFields converts the orderBy argument into the database sort spec
+func userSortFields(orderBy []*model.UserOrder) []database.SortField {
+	var fields []database.SortField
+
+	for _, order := range orderBy {
+		field := database.SortField{
+			Property:   userOrderProperties[order.Field],
+			Descending: order.Direction != nil && *order.Direction == model.SortDirectionDesc,
+		}
+
+		if order.Nulls != nil {
+			switch *order.Nulls {
+			case model.NullsOrderFirst:
+				field.Nulls = database.NullsFirst
+			case model.NullsOrderLast:
+				field.Nulls = database.NullsLast
+			}
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// edgeDirections maps the schema's directions to the database's
+var edgeDirections = map[model.Direction]database.Direction{
+	model.DirectionBoth:     database.DirectionBoth,
+	model.DirectionOutgoing: database.DirectionOutgoing,
+	model.DirectionIncoming: database.DirectionIncoming,
+}
@@ -0,0 +1,87 @@
+package graph
+
+import (
+	"errors"
+	"gql/database"
+	"testing"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestBatchReference(t *testing.T) {
+	// Operation 1 related users rather than writing one
+	userIds := []string{"u0", "", "u2"}
+
+	tests := []struct {
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{"u9", "u9", false},
+		{"$0", "u0", false},
+		{"$2", "u2", false},
+		{"$1", "", true},
+		{"$3", "", true},
+		{"$-1", "", true},
+		{"$x", "", true},
+		{"$", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			got, err := batchReference(tt.id, userIds)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("batchReference() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("batchReference() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOperationError(t *testing.T) {
+	internal := errors.New("connection reset")
+
+	tests := []struct {
+		name        string
+		err         error
+		wantMessage string
+		wantType    string
+	}{
+		{"client error", gqlerror.Errorf("exactly one field"), "operation 2: exactly one field", "gqlerror"},
+		{"validation error", &database.ValidationError{Message: "name is required"}, "operation 2: name is required", "validation"},
+		{"internal error", internal, "operation 2: connection reset", "internal"},
+		{"unavailable", database.ErrUnavailable, "operation 2: database unavailable", "internal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := operationError(2, tt.err)
+
+			// The error must still be presented as the kind it was
+			var clientErr *gqlerror.Error
+			var validationErr *database.ValidationError
+			message := got.Error()
+			switch tt.wantType {
+			case "gqlerror":
+				if !errors.As(got, &clientErr) {
+					t.Fatalf("operationError() = %T, want a gqlerror", got)
+				}
+				message = clientErr.Message
+			case "validation":
+				if !errors.As(got, &validationErr) {
+					t.Errorf("operationError() = %T, want a ValidationError", got)
+				}
+			case "internal":
+				if !errors.Is(got, tt.err) {
+					t.Errorf("operationError() doesn't wrap %v", tt.err)
+				}
+			}
+
+			if message != tt.wantMessage {
+				t.Errorf("operationError() = %q, want %q", message, tt.wantMessage)
+			}
+		})
+	}
+}
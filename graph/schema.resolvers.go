@@ -5,44 +5,106 @@ package graph
 
 import (
 	"context"
-	"fmt"
+	"gql/auth"
+	"gql/database"
 	"gql/graph/generated"
 	"gql/graph/model"
+	"time"
 
-	"github.com/gofrs/uuid"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
-func (r *mutationResolver) UpsertUser(ctx context.Context, input model.UserInput) (*model.User, error) {
-	// Update or insert defined by the presence of an user ID value?
-	var userId string
+func (r *mutationResolver) UpsertUser(ctx context.Context, input model.UserInput, idempotencyKey *string) (*model.User, error) {
+	var user *model.User
 
-	if input.ID != nil {
-		userId = *input.ID
-	} else {
-		newUuid, err := uuid.NewV4() // Create a Version 4 UUID.
-		if err != nil {
-			return nil, fmt.Errorf("UUID creation error %v", err)
-		}
-		userId = newUuid.String()
+	err := idempotent(ctx, "upsertUser", idempotencyKey, input, &user, func(ctx context.Context) error {
+		var err error
+		user, err = r.SaveUser(ctx, input)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
-	user := model.User{
-		ID:       userId,
-		Name:     input.Name,
-		UserType: input.UserType}
+	return user, nil
+}
 
-	result, err := r.UpdateInsertUser(user)
+func (r *mutationResolver) Relate(ctx context.Context, input model.RelationshipInput) (*model.Relationship, error) {
+	edge := database.Edge{
+		Type:   input.Type,
+		From:   input.From,
+		To:     input.To,
+		Since:  input.Since,
+		Until:  input.Until,
+		Weight: input.Weight,
+	}
 
-	return result, err
+	if input.Role != nil {
+		edge.Role = *input.Role
+	}
+
+	return r.RelateUsers(ctx, edge)
+}
+
+func (r *mutationResolver) Unrelate(ctx context.Context, typeArg string, from string, to string) (bool, error) {
+	return Users.Unrelate(ctx, Users, typeArg, from, to)
 }
 
-func (r *queryResolver) User(ctx context.Context, id string) (*model.User, error) {
+func (r *mutationResolver) Batch(ctx context.Context, operations []*model.Operation, idempotencyKey *string) ([]*model.OperationResult, error) {
+	if len(operations) > MaxBatchOperations {
+		return nil, gqlerror.Errorf("a batch may have at most %d operations", MaxBatchOperations)
+	}
+
+	var results []*model.OperationResult
+
+	err := idempotent(ctx, "batch", idempotencyKey, operations, &results, func(ctx context.Context) error {
+		// Everything is written in one transaction, the first failure rolls back the operations before it
+		return database.InTransaction(ctx, func(ctx context.Context) error {
+			results = make([]*model.OperationResult, len(operations))
+			userIds := make([]string, len(operations))
+
+			for index, operation := range operations {
+				result, err := r.applyOperation(ctx, operation, userIds[:index])
+				if err != nil {
+					return operationError(index, err)
+				}
+				if result.User != nil {
+					userIds[index] = result.User.ID
+				}
+				results[index] = result
+			}
+
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (r *mutationResolver) RevertUser(ctx context.Context, id string, toVersion int) (*model.User, error) {
+	if !auth.ForContext(ctx).IsAdmin() {
+		return nil, gqlerror.Errorf("only an admin may revert a user")
+	}
+
+	if toVersion < 1 {
+		return nil, gqlerror.Errorf("toVersion must be at least one")
+	}
+
+	return r.RevertUserVersion(ctx, model.User{ID: id}, toVersion)
+}
+
+func (r *queryResolver) User(ctx context.Context, id string, asOf *time.Time) (*model.User, error) {
 	user := model.User{
 		ID:       id,
 		Name:     "",
 		UserType: ""}
 
-	result, err := r.QueryUser(user)
+	result, err := r.QueryUser(ctx, user, asOf)
 
 	if err != nil {
 		return nil, err
@@ -51,15 +113,30 @@ func (r *queryResolver) User(ctx context.Context, id string) (*model.User, error
 	return result, err
 }
 
-func (r *queryResolver) Users(ctx context.Context, userType model.UserType) ([]*model.User, error) {
+func (r *queryResolver) UserHistory(ctx context.Context, id string) ([]*model.UserVersion, error) {
+	if !auth.ForContext(ctx).IsAdmin() {
+		return nil, gqlerror.Errorf("user history is only available to admins")
+	}
 
+	return r.QueryUserHistory(ctx, model.User{ID: id})
+}
+
+func (r *queryResolver) Users(ctx context.Context, userType model.UserType, first *int, orderBy []*model.UserOrder) ([]*model.User, error) {
 	queryUser := model.User{
 		ID:       "",
 		Name:     "",
 		UserType: userType,
 	}
 
-	users, err := r.QueryUsers(queryUser)
+	var limit int64
+	if first != nil {
+		if *first < 0 {
+			return nil, gqlerror.Errorf("first must not be negative")
+		}
+		limit = int64(*first)
+	}
+
+	users, err := r.QueryUsers(ctx, queryUser, limit, orderBy)
 
 	if err != nil {
 		return nil, err
@@ -68,11 +145,77 @@ func (r *queryResolver) Users(ctx context.Context, userType model.UserType) ([]*
 	return users, nil
 }
 
+func (r *queryResolver) GraphAnalytics(ctx context.Context, types []string, top *int, refresh *bool) (*model.GraphAnalytics, error) {
+	if !auth.ForContext(ctx).IsAdmin() {
+		return nil, gqlerror.Errorf("graph analytics are only available to admins")
+	}
+
+	centrality := 20
+	if top != nil {
+		if *top < 0 {
+			return nil, gqlerror.Errorf("top must not be negative")
+		}
+		centrality = *top
+	}
+
+	return r.QueryGraphAnalytics(ctx, types, centrality, refresh != nil && *refresh)
+}
+
+func (r *userResolver) Relationships(ctx context.Context, obj *model.User, direction *model.Direction, types []string, asOf *time.Time, first *int) ([]*model.Relationship, error) {
+	edgeQuery := database.EdgeQuery{
+		Types: types,
+		AsOf:  asOf,
+	}
+
+	if direction != nil {
+		edgeQuery.Direction = edgeDirections[*direction]
+	}
+
+	if first != nil {
+		if *first < 0 {
+			return nil, gqlerror.Errorf("first must not be negative")
+		}
+		edgeQuery.Limit = int64(*first)
+	}
+
+	return r.QueryRelationships(ctx, *obj, edgeQuery)
+}
+
+func (r *userResolver) SuggestedPeers(ctx context.Context, obj *model.User, limit *int) ([]*model.PeerSuggestion, error) {
+	peers := 0
+	if limit != nil {
+		if *limit < 0 || *limit > database.MaxPeerSuggestions {
+			return nil, gqlerror.Errorf("limit must be between 0 and %d", database.MaxPeerSuggestions)
+		}
+		peers = *limit
+	}
+
+	return r.QuerySuggestedPeers(ctx, *obj, peers)
+}
+
+func (r *userResolver) Neighbourhood(ctx context.Context, obj *model.User, depth *int, types []string, asOf *time.Time) (*model.Neighbourhood, error) {
+	neighbourhoodQuery := database.NeighbourhoodQuery{
+		Depth: 1,
+		Types: types,
+		AsOf:  asOf,
+	}
+
+	if depth != nil {
+		neighbourhoodQuery.Depth = *depth
+	}
+
+	return r.QueryNeighbourhood(ctx, *obj, neighbourhoodQuery)
+}
+
 // Mutation returns generated.MutationResolver implementation.
 func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
 
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
+// User returns generated.UserResolver implementation.
+func (r *Resolver) User() generated.UserResolver { return &userResolver{r} }
+
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"gql/database"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+/* Set while the server should receive traffic, cleared at the start of shutdown so the orchestrator drains it */
+var ready int32
+
+type healthResponse struct {
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latencyMs,omitempty"`
+}
+
+/* Liveness, the process is running and able to serve HTTP */
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+/* Readiness, the server is not shutting down and Neo4j answers a read within timeout */
+func readyzHandler(timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&ready) == 0 {
+			writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "shutting down"})
+			return
+		}
+
+		latency, err := database.CheckHealth(r.Context(), timeout)
+		response := healthResponse{Status: "ok", LatencyMs: float64(latency.Microseconds()) / 1000}
+
+		if err != nil {
+			response.Status = "unavailable"
+			response.Error = err.Error()
+			writeHealth(w, http.StatusServiceUnavailable, response)
+			return
+		}
+
+		writeHealth(w, http.StatusOK, response)
+	}
+}
+
+func writeHealth(w http.ResponseWriter, status int, response healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
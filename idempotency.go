@@ -0,0 +1,23 @@
+package main
+
+import (
+	"gql/database"
+	"net/http"
+	"strings"
+)
+
+/* Clients retrying a mutation send the same key so it is only applied once */
+const idempotencyHeader = "Idempotency-Key"
+
+/*
+Reads the idempotency key into the database context, where the mutations that support one find it.
+A request with several such mutations should give each its own key with their idempotencyKey argument.
+*/
+func idempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := strings.TrimSpace(r.Header.Get(idempotencyHeader)); key != "" {
+			r = r.WithContext(database.WithIdempotencyKey(r.Context(), key))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"gql/utility"
+	"net"
+	"os"
+	"sync"
+)
+
+/* Holds the current TLS certificate so it can be replaced without restarting the server */
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+/* Reads the certificate and key again, the old pair stays in use if either file is invalid */
+func (c *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load TLS certificate %s and key %s: %w", c.certFile, c.keyFile, err)
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+/* Where and how the HTTP server accepts connections */
+type serverListener struct {
+	listener net.Listener
+	tls      *certReloader
+	url      string
+}
+
+/* Opens a Unix domain socket when configured otherwise a TCP port on the bind address, with TLS when a certificate is given */
+func newServerListener(config utility.Config, port string) (*serverListener, error) {
+	if (config.TlsCertFile == "") != (config.TlsKeyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	result := &serverListener{}
+	scheme := "http"
+
+	if config.TlsCertFile != "" {
+		reloader, err := newCertReloader(config.TlsCertFile, config.TlsKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		result.tls = reloader
+		scheme = "https"
+	}
+
+	if config.UnixSocket != "" {
+		// A socket left behind by an unclean exit would stop the listen, anything else at the path is kept
+		if info, err := os.Lstat(config.UnixSocket); err == nil {
+			if info.Mode()&os.ModeSocket == 0 {
+				return nil, fmt.Errorf("%s exists and is not a socket", config.UnixSocket)
+			}
+			if err := os.Remove(config.UnixSocket); err != nil {
+				return nil, fmt.Errorf("cannot remove stale socket %s: %w", config.UnixSocket, err)
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("cannot check socket path %s: %w", config.UnixSocket, err)
+		}
+
+		listener, err := net.Listen("unix", config.UnixSocket)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only the owner and group, normally the reverse proxy, may connect
+		if err = os.Chmod(config.UnixSocket, 0o660); err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+
+		result.listener = listener
+		result.url = scheme + "+unix://" + config.UnixSocket
+		return result, nil
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(config.BindAddress, port))
+	if err != nil {
+		return nil, err
+	}
+
+	host := config.BindAddress
+	if host == "" {
+		host = "localhost"
+	}
+
+	result.listener = listener
+	result.url = scheme + "://" + net.JoinHostPort(host, port)
+	return result, nil
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"context"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/sirupsen/logrus"
+)
+
+// Extension logs every GraphQL operation and resolver with its duration
+type Extension struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.ResponseInterceptor
+	graphql.FieldInterceptor
+} = Extension{}
+
+func (e Extension) ExtensionName() string {
+	return "Logging"
+}
+
+func (e Extension) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (e Extension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	start := time.Now()
+	response := next(ctx)
+
+	entry := FromContext(ctx).WithField("duration_ms", milliseconds(time.Since(start)))
+
+	if response != nil && len(response.Errors) > 0 {
+		entry.WithField("errors", len(response.Errors)).Warn("graphql operation completed with errors")
+	} else {
+		entry.Info("graphql operation completed")
+	}
+
+	return response
+}
+
+func (e Extension) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+
+	if fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+
+	start := time.Now()
+	res, err := next(ctx)
+
+	entry := FromContext(ctx).WithFields(logrus.Fields{
+		"field":       fc.Object + "." + fc.Field.Name,
+		"duration_ms": milliseconds(time.Since(start)),
+	})
+
+	if err != nil {
+		entry.WithError(err).Warn("resolver failed")
+	} else {
+		entry.Debug("resolver completed")
+	}
+
+	return res, err
+}
+
+// milliseconds keeps sub millisecond precision for fast resolvers
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Setup configures the application logger, format is json or logfmt and level any logrus level name.
+// Output from the standard library log package is sent through the same logger.
+func Setup(format, level string) error {
+	logger := logrus.StandardLogger()
+
+	switch format {
+	case "json":
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	case "logfmt":
+		logger.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+	default:
+		return fmt.Errorf("LOG_FORMAT must be json or logfmt not %q", format)
+	}
+
+	parsedLevel, err := logrus.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("LOG_LEVEL %w", err)
+	}
+	logger.SetLevel(parsedLevel)
+
+	log.SetFlags(0)
+	log.SetOutput(logger.WriterLevel(logrus.InfoLevel))
+
+	return nil
+}
+
+// FromContext returns a log entry carrying the request id, GraphQL operation name and trace id found in ctx
+func FromContext(ctx context.Context) *logrus.Entry {
+	entry := logrus.NewEntry(logrus.StandardLogger())
+
+	if ctx == nil {
+		return entry
+	}
+
+	if id := RequestID(ctx); id != "" {
+		entry = entry.WithField("request_id", id)
+	}
+
+	if graphql.HasOperationContext(ctx) {
+		if name := graphql.GetOperationContext(ctx).OperationName; name != "" {
+			entry = entry.WithField("operation", name)
+		}
+	}
+
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		entry = entry.WithField("trace_id", spanContext.TraceID().String())
+	}
+
+	return entry
+}
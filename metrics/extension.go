@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// Extension records operation and resolver field metrics for the GraphQL server
+type Extension struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.ResponseInterceptor
+	graphql.FieldInterceptor
+} = Extension{}
+
+func (e Extension) ExtensionName() string {
+	return "Metrics"
+}
+
+func (e Extension) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (e Extension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	start := time.Now()
+	response := next(ctx)
+
+	operation := operationName(ctx)
+	operationRequests.WithLabelValues(operation).Inc()
+	operationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+
+	if response != nil && len(response.Errors) > 0 {
+		operationErrors.WithLabelValues(operation).Inc()
+	}
+
+	return response
+}
+
+func (e Extension) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+
+	// Plain struct fields are free, only measure fields that call a resolver
+	if fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+
+	start := time.Now()
+	res, err := next(ctx)
+
+	fieldRequests.WithLabelValues(fc.Object, fc.Field.Name).Inc()
+	fieldDuration.WithLabelValues(fc.Object, fc.Field.Name).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		fieldErrors.WithLabelValues(fc.Object, fc.Field.Name).Inc()
+	}
+
+	return res, err
+}
+
+// Placeholders for operations without a usable name and for names past maxOperationNames
+const (
+	unknownOperation   = "unknown"
+	anonymousOperation = "anonymous"
+	otherOperation     = "other"
+)
+
+// maxOperationNames bounds the operation label, clients choose the names so they must not grow the series forever
+const maxOperationNames = 200
+
+var (
+	operationNamesMu sync.Mutex
+	operationNames   = make(map[string]bool)
+)
+
+// operationName labels an operation by the name in its validated document. Operations that failed to parse or
+// validate are unknown, unnamed ones anonymous, and once maxOperationNames names have been seen new ones are other.
+func operationName(ctx context.Context) string {
+	if !graphql.HasOperationContext(ctx) {
+		return unknownOperation
+	}
+
+	rc := graphql.GetOperationContext(ctx)
+	if rc == nil || rc.Doc == nil || rc.Operation == nil {
+		return unknownOperation
+	}
+	if rc.Operation.Name == "" {
+		return anonymousOperation
+	}
+
+	return boundedName(rc.Operation.Name)
+}
+
+// boundedName returns name while fewer than maxOperationNames distinct names have been labelled
+func boundedName(name string) string {
+	operationNamesMu.Lock()
+	defer operationNamesMu.Unlock()
+
+	if !operationNames[name] {
+		if len(operationNames) >= maxOperationNames {
+			return otherOperation
+		}
+		operationNames[name] = true
+	}
+
+	return name
+}
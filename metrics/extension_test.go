@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestOperationName(t *testing.T) {
+	named := &ast.OperationDefinition{Operation: ast.Query, Name: "Students"}
+	anonymous := &ast.OperationDefinition{Operation: ast.Query}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"no operation context", context.Background(), unknownOperation},
+		{
+			"failed to parse",
+			graphql.WithOperationContext(context.Background(), &graphql.OperationContext{RawQuery: "{ users(", OperationName: "Sneaky"}),
+			unknownOperation,
+		},
+		{
+			"named",
+			graphql.WithOperationContext(context.Background(), &graphql.OperationContext{
+				Doc: &ast.QueryDocument{Operations: ast.OperationList{named}}, Operation: named,
+			}),
+			"Students",
+		},
+		{
+			"anonymous whatever the client calls it",
+			graphql.WithOperationContext(context.Background(), &graphql.OperationContext{
+				Doc: &ast.QueryDocument{Operations: ast.OperationList{anonymous}}, Operation: anonymous, OperationName: "Sneaky",
+			}),
+			anonymousOperation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := operationName(tt.ctx); got != tt.want {
+				t.Errorf("operationName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBoundedName(t *testing.T) {
+	operationNamesMu.Lock()
+	operationNames = make(map[string]bool)
+	operationNamesMu.Unlock()
+
+	for i := 0; i < maxOperationNames; i++ {
+		if got := boundedName(fmt.Sprintf("Operation%d", i)); got != fmt.Sprintf("Operation%d", i) {
+			t.Fatalf("boundedName() = %q before the limit", got)
+		}
+	}
+
+	if got := boundedName("OneTooMany"); got != otherOperation {
+		t.Errorf("boundedName() past the limit = %q, want %q", got, otherOperation)
+	}
+	if got := boundedName("Operation0"); got != "Operation0" {
+		t.Errorf("boundedName() of a known name past the limit = %q", got)
+	}
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	operationRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphql_operations_total",
+		Help: "GraphQL operations executed by operation name.",
+	}, []string{"operation"})
+
+	operationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphql_operation_errors_total",
+		Help: "GraphQL operations that returned one or more errors by operation name.",
+	}, []string{"operation"})
+
+	operationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "graphql_operation_duration_seconds",
+		Help:    "Time taken to execute GraphQL operations by operation name.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	fieldRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphql_field_resolutions_total",
+		Help: "Resolver backed GraphQL fields resolved by type and field.",
+	}, []string{"object", "field"})
+
+	fieldErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphql_field_errors_total",
+		Help: "Resolver backed GraphQL fields that returned an error by type and field.",
+	}, []string{"object", "field"})
+
+	fieldDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "graphql_field_duration_seconds",
+		Help:    "Time taken by GraphQL field resolvers by type and field.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"object", "field"})
+
+	cypherDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "neo4j_query_duration_seconds",
+		Help:    "Time taken to execute Cypher transactions by database function and access mode.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"function", "mode"})
+
+	cypherErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "neo4j_query_errors_total",
+		Help: "Cypher transactions that failed by database function and access mode.",
+	}, []string{"function", "mode"})
+
+	sessionsOpened = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "neo4j_sessions_opened_total",
+		Help: "Neo4j sessions opened by access mode.",
+	}, []string{"mode"})
+
+	sessionsActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "neo4j_sessions_active",
+		Help: "Neo4j sessions currently open by access mode.",
+	}, []string{"mode"})
+)
+
+// SessionOpened records a new database session, call the returned function when the session closes
+func SessionOpened(mode string) func() {
+	sessionsOpened.WithLabelValues(mode).Inc()
+	sessionsActive.WithLabelValues(mode).Inc()
+
+	return func() {
+		sessionsActive.WithLabelValues(mode).Dec()
+	}
+}
+
+// ObserveQuery records the duration and outcome of a Cypher transaction started at start
+func ObserveQuery(function, mode string, start time.Time, err error) {
+	cypherDuration.WithLabelValues(function, mode).Observe(time.Since(start).Seconds())
+	if err != nil {
+		cypherErrors.WithLabelValues(function, mode).Inc()
+	}
+}
+
+var (
+	breakerState = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "neo4j_circuit_breaker_state",
+		Help: "Neo4j circuit breaker state, 0 closed, 1 open, 2 half open.",
+	})
+
+	breakerTrips = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "neo4j_circuit_breaker_trips_total",
+		Help: "Times the Neo4j circuit breaker has opened.",
+	})
+)
+
+// BreakerState publishes the circuit breaker state
+func BreakerState(state int) {
+	breakerState.Set(float64(state))
+}
+
+// BreakerTripped counts the circuit breaker opening
+func BreakerTripped() {
+	breakerTrips.Inc()
+}
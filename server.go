@@ -2,36 +2,192 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/cors"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"gql/analytics"
+	"gql/auth"
 	"gql/database"
 	"gql/graph"
 	"gql/graph/generated"
+	"gql/logging"
+	"gql/metrics"
+	"gql/tracing"
 	"gql/utility"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
-/* Runs the server on a thread */
-func startHttpServer(wg *sync.WaitGroup, defaultPort string) *http.Server {
-	srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: &graph.Resolver{}}))
+/* Builds the GraphQL handler with its transports and extensions */
+func newGraphQLServer(config utility.Config, policy utility.Policy) (*handler.Server, error) {
+	srv := handler.New(generated.NewExecutableSchema(generated.Config{
+		Resolvers:  &graph.Resolver{Analytics: analytics.NewCache(config.AnalyticsCacheTtl)},
+		Complexity: graph.NewComplexityRoot(),
+	}))
+
+	srv.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+		Upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				return originAllowed(policy.AllowedOrigins, r.Header.Get("Origin"))
+			},
+		},
+	})
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{})
+
+	srv.SetQueryCache(lru.New(1000))
+
+	if policy.Introspection {
+		srv.Use(extension.Introspection{})
+	}
+
+	// Hide internal error details outside development
+	srv.SetErrorPresenter(graph.NewErrorPresenter(policy.DetailedErrors))
+
+	// Strict mode only runs operations from the allow-list, otherwise clients may register their own
+	if config.StrictOperations {
+		allowList, err := graph.LoadAllowList(config.OperationAllowList)
+		if err != nil {
+			return nil, err
+		}
+		srv.Use(allowList)
+	} else {
+		switch config.PersistedQueryCache {
+		case "memory":
+			srv.Use(extension.AutomaticPersistedQuery{Cache: lru.New(config.PersistedQueryCacheSize)})
+		case "file":
+			cache, err := graph.NewFileQueryCache(config.PersistedQueryDir, config.PersistedQueryCacheSize)
+			if err != nil {
+				return nil, err
+			}
+			srv.Use(extension.AutomaticPersistedQuery{Cache: cache})
+		case "none":
+		default:
+			return nil, fmt.Errorf("unknown persisted query cache %q", config.PersistedQueryCache)
+		}
+	}
+
+	// Reject expensive or deeply nested operations before they reach the database
+	srv.Use(graph.NewComplexityLimit(config.ComplexityLimit))
+	srv.Use(&graph.DepthLimit{Limit: config.MaxQueryDepth})
+
+	// Operation and resolver logs with request id and duration
+	srv.Use(logging.Extension{})
+
+	// Read your writes across a cluster
+	srv.Use(graph.Bookmarks{})
+
+	// Operation and resolver metrics exposed on /metrics
+	srv.Use(metrics.Extension{})
+
+	// Operation and resolver spans, children of the HTTP request span
+	srv.Use(tracing.Extension{})
+
+	return srv, nil
+}
+
+/* Reports whether a browser origin may call the API, requests without an origin are not cross site */
+func originAllowed(allowedOrigins []string, origin string) bool {
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
 
-	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
+/* Runs the server on a thread */
+func startHttpServer(wg *sync.WaitGroup, listener *serverListener, srv *handler.Server, config utility.Config, policy utility.Policy, tracker *connectionTracker) *http.Server {
+	if policy.Playground {
+		http.Handle("/", playground.Handler("GraphQL playground", "/query"))
+	}
 	http.Handle("/query", srv)
+	http.HandleFunc("/graph", graphExportHandler)
+	http.HandleFunc("/healthz", healthzHandler)
+	http.Handle("/readyz", readyzHandler(config.ReadinessTimeout))
+	http.Handle("/metrics", promhttp.Handler())
 
-	serv := &http.Server{Addr: ":" + defaultPort}
+	corsHandler := cors.New(cors.Options{
+		AllowOriginFunc: func(origin string) bool {
+			return originAllowed(policy.AllowedOrigins, origin)
+		},
+		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{bookmarkHeader, truncatedHeader},
+		AllowCredentials: true,
+	})
+
+	// Middleware runs outermost first, tracing, request id, connection tracking, CORS, authentication, bookmarks
+	// then idempotency keys
+	var chain http.Handler = idempotencyMiddleware(http.DefaultServeMux)
+	chain = bookmarkMiddleware(chain)
+	chain = auth.Middleware([]byte(config.AuthJwtSecret), config.DefaultInstitution, chain)
+	chain = corsHandler.Handler(chain)
+	chain = tracker.middleware(chain)
+	chain = logging.RequestIDMiddleware(chain)
+
+	// Trace every request except the health and metrics probes
+	tracedHandler := otelhttp.NewHandler(chain, "http.server",
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return r.URL.Path != "/healthz" && r.URL.Path != "/readyz" && r.URL.Path != "/metrics"
+		}),
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}))
+
+	serv := &http.Server{Handler: tracedHandler}
+
+	if listener.tls != nil {
+		serv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: listener.tls.getCertificate,
+		}
+	}
+
+	// Shutdown does not wait for hijacked connections so tell websocket clients to go away
+	serv.RegisterOnShutdown(func() {
+		log.Printf("main: closing %d websocket connections", tracker.closeSockets())
+	})
 
 	go func() {
 		defer wg.Done() // let main know we are done cleaning up
-		log.Printf("connect to http://localhost:%s/ for GraphQL playground", defaultPort)
+		if policy.Playground {
+			log.Printf("connect to %s/ for GraphQL playground", listener.url)
+		} else {
+			log.Printf("serving GraphQL at %s/query", listener.url)
+		}
+
 		// always returns error. ErrServerClosed on graceful close
-		if err := serv.ListenAndServe(); err != http.ErrServerClosed {
-			// unexpected error. port in use?
-			log.Fatalf("ListenAndServe(): %v", err)
+		var err error
+		if listener.tls != nil {
+			// certificates come from TLSConfig.GetCertificate
+			err = serv.ServeTLS(listener.listener, "", "")
+		} else {
+			err = serv.Serve(listener.listener)
+		}
+		if err != http.ErrServerClosed {
+			// unexpected error
+			log.Fatalf("Serve(): %v", err)
 		}
 	}()
 
@@ -41,51 +197,175 @@ func startHttpServer(wg *sync.WaitGroup, defaultPort string) *http.Server {
 
 func main() {
 
-	config, err := utility.LoadConfig(".")
+	flags := utility.NewFlagSet(os.Args[0])
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		log.Fatal("cannot parse flags: ", err)
+	}
+
+	config, err := utility.LoadConfig(".", flags)
+
+	// Commands, the server runs when none is given
+	if command := strings.Join(flags.Args(), " "); command != "" {
+		switch command {
+		case "config print":
+			// Print even an invalid config, it helps to see why
+			if printErr := config.Print(os.Stdout); printErr != nil {
+				log.Fatal(printErr)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		default:
+			log.Fatalf("unknown command %q", command)
+		}
+	}
+
 	if err != nil {
-		log.Fatal("cannot load config:", err)
+		log.Fatal("cannot load config: ", err)
 	}
 
 	// fmt.Println(config)
 
-	// Connect to neo4j
-	err = database.CreateDriver(config.Neo4jUri, config.Neo4jUser, config.Neo4jPassword)
+	if err = logging.Setup(config.LogFormat, config.LogLevel); err != nil {
+		log.Fatal("cannot load config:", err)
+	}
+
+	// Export traces before anything can create spans
+	shutdownTracing, err := tracing.Setup(config.TracingExporter, config.OtlpEndpoint, config.OtlpInsecure, config.ServiceName)
+	if err != nil {
+		log.Fatal("cannot set up tracing ", err)
+	}
 	defer func() {
-		_ = database.CloseDriver()
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Println(err)
+		}
 	}()
 
+	// Connect to neo4j
+	database.QueryTimeout = config.QueryTimeout
+	database.IdempotencyTTL = config.IdempotencyKeyTtl
+	database.Retry = database.RetryPolicy{
+		MaxAttempts:    config.Neo4jRetryAttempts,
+		InitialBackoff: config.Neo4jRetryInitialBackoff,
+		MaxBackoff:     config.Neo4jRetryMaxBackoff,
+	}
+	database.Breaker = database.NewCircuitBreaker(config.Neo4jBreakerThreshold, config.Neo4jBreakerCooldown)
+	err = database.CreateDriver(config.Neo4jUri, config.Neo4jUser, config.Neo4jPassword, database.DriverSettings{
+		DatabaseName:                 config.Neo4jDatabase,
+		MaxConnectionPoolSize:        config.Neo4jMaxConnectionPoolSize,
+		ConnectionAcquisitionTimeout: config.Neo4jConnectionAcquisitionTimeout,
+		MaxConnectionLifetime:        config.Neo4jMaxConnectionLifetime,
+		Encryption:                   config.Neo4jEncryption,
+		CaCertFile:                   config.Neo4jCaCertFile,
+	})
 	if err != nil {
 		log.Fatal("cannot load database driver ", err)
 	}
 
+	// Keys must be unique before anything is written, the labels registered themselves when their packages loaded
+	constraintsCtx, cancelConstraints := context.WithTimeout(context.Background(), config.QueryTimeout)
+	err = database.EnsureConstraints(constraintsCtx)
+	cancelConstraints()
+	if err != nil {
+		log.Fatal("cannot create database constraints ", err)
+	}
+
+	// Nodes written before nodes were scoped to an institution belong to the default one, without it they stay hidden
+	if config.DefaultInstitution != "" {
+		// Every batch is held to QUERY_TIMEOUT, however many batches there are
+		assigned, err := database.AssignInstitution(context.Background(), config.DefaultInstitution)
+		if err != nil {
+			log.Fatal("cannot assign unscoped nodes to the default institution ", err)
+		}
+		if assigned > 0 {
+			log.Printf("main: assigned %d nodes without an institution to %s", assigned, config.DefaultInstitution)
+		}
+	} else {
+		log.Printf("main: DEFAULT_INSTITUTION is not set, nodes written without an institution stay hidden")
+	}
+
+	policy, err := config.Policy()
+	if err != nil {
+		log.Fatal("cannot load config:", err)
+	}
+
+	gqlServer, err := newGraphQLServer(config, policy)
+	if err != nil {
+		log.Fatal("cannot create GraphQL server ", err)
+	}
+
 	// Override default if set in env
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = config.DefaultPort
 	}
 
+	// Opening the listener here means a port in use or bad certificate stops start up
+	listener, err := newServerListener(config, port)
+	if err != nil {
+		log.Fatal("cannot listen ", err)
+	}
+
+	// Admin only fields check the caller's role, which only a bearer token carries
+	if config.AuthJwtSecret == "" {
+		log.Printf("main: AUTH_JWT_SECRET is not set, authentication is off and admin only fields always fail")
+	}
+
 	log.Printf("main: starting HTTP server")
 
 	// Run server on separate thread
 	httpServerExitDone := &sync.WaitGroup{}
 	httpServerExitDone.Add(1)
-	srv := startHttpServer(httpServerExitDone, config.DefaultPort)
+	tracker := newConnectionTracker()
+	srv := startHttpServer(httpServerExitDone, listener, gqlServer, config, policy, tracker)
+	atomic.StoreInt32(&ready, 1)
+
+	// Reload the TLS certificate on SIGHUP so renewed certificates are used without a restart
+	if listener.tls != nil {
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		go func() {
+			for range hangup {
+				if err := listener.tls.reload(); err != nil {
+					log.Printf("main: keeping previous certificate: %v", err)
+					continue
+				}
+				log.Printf("main: reloaded TLS certificate")
+			}
+		}()
+	}
 
 	// Setting up signal capturing then wait for the ctrl+c
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
 
-	log.Printf("main: stopping HTTP server")
+	// Fail readiness first and give the orchestrator time to stop routing traffic here
+	atomic.StoreInt32(&ready, 0)
+	log.Printf("main: draining for %v", config.ShutdownDrainDelay)
+	time.Sleep(config.ShutdownDrainDelay)
 
-	// now close the server gracefully ("shutdown")
-	// timeout could be given with a proper context
-	if err := srv.Shutdown(context.Background()); err != nil {
-		panic(err) // failure/timeout shutting down the server gracefully
+	log.Printf("main: stopping HTTP server, %d requests in flight", tracker.requestsInFlight())
+
+	// The drain delay is not part of the shutdown timeout
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	// now close the server gracefully ("shutdown"), running requests including mutations are allowed to finish
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		// timed out, drop whatever is left rather than hang
+		log.Printf("main: graceful shutdown failed with %d requests in flight: %v", tracker.requestsInFlight(), err)
+		_ = srv.Close()
 	}
 
 	// wait for goroutine started in startHttpServer() to stop
 	httpServerExitDone.Wait()
 
+	// Only now nothing can start a new transaction, let running ones commit or roll back then close neo4j
+	if err := database.CloseDriver(shutdownCtx); err != nil {
+		log.Println(err)
+	}
+
 	log.Printf("main: done. exiting")
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+/* Tracks requests being served so shutdown can report progress and end long lived websockets */
+type connectionTracker struct {
+	inFlight int64
+
+	mu         sync.Mutex
+	nextSocket int
+	sockets    map[int]context.CancelFunc
+}
+
+func newConnectionTracker() *connectionTracker {
+	return &connectionTracker{sockets: make(map[int]context.CancelFunc)}
+}
+
+/* Counts ordinary requests and gives websocket requests a context that closeSockets can cancel */
+func (t *connectionTracker) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") == "" {
+			atomic.AddInt64(&t.inFlight, 1)
+			defer atomic.AddInt64(&t.inFlight, -1)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The websocket transport sends the close reason to the client when the context is cancelled
+		ctx, cancel := context.WithCancel(transport.AppendCloseReason(r.Context(), "server shutting down"))
+		defer cancel()
+
+		t.mu.Lock()
+		id := t.nextSocket
+		t.nextSocket++
+		t.sockets[id] = cancel
+		t.mu.Unlock()
+
+		defer func() {
+			t.mu.Lock()
+			delete(t.sockets, id)
+			t.mu.Unlock()
+		}()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+/* Number of non websocket requests still being served */
+func (t *connectionTracker) requestsInFlight() int64 {
+	return atomic.LoadInt64(&t.inFlight)
+}
+
+/* Notifies every open websocket that the server is going away and closes it, returns how many were open */
+func (t *connectionTracker) closeSockets() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, cancel := range t.sockets {
+		cancel()
+	}
+
+	return len(t.sockets)
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Extension creates a span for each GraphQL operation and each resolver backed field
+type Extension struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.ResponseInterceptor
+	graphql.FieldInterceptor
+} = Extension{}
+
+func (e Extension) ExtensionName() string {
+	return "Tracing"
+}
+
+func (e Extension) Validate(schema graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (e Extension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	if !graphql.HasOperationContext(ctx) {
+		return next(ctx)
+	}
+
+	rc := graphql.GetOperationContext(ctx)
+
+	name := rc.OperationName
+	if name == "" {
+		name = "anonymous"
+	}
+
+	attributes := []attribute.KeyValue{attribute.String("graphql.operation.name", name)}
+	if rc.Operation != nil {
+		attributes = append(attributes, attribute.String("graphql.operation.type", string(rc.Operation.Operation)))
+	}
+
+	ctx, span := Tracer().Start(ctx, "graphql."+name, trace.WithAttributes(attributes...))
+	defer span.End()
+
+	response := next(ctx)
+
+	if response != nil && len(response.Errors) > 0 {
+		span.SetStatus(codes.Error, response.Errors.Error())
+	}
+
+	return response
+}
+
+func (e Extension) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+
+	// Plain struct fields would only add noise, trace fields that call a resolver
+	if fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+
+	ctx, span := Tracer().Start(ctx, fmt.Sprintf("%s.%s", fc.Object, fc.Field.Name), trace.WithAttributes(
+		attribute.String("graphql.field.path", fc.Path().String()),
+	))
+
+	res, err := next(ctx)
+	End(span, err)
+
+	return res, err
+}
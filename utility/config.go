@@ -1,29 +1,256 @@
 package utility
 
 import (
+	"fmt"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Neo4jUri      string `mapstructure:"NEO4J_URI"`
-	Neo4jUser     string `mapstructure:"NEO4J_USER"`
-	Neo4jPassword string `mapstructure:"NEO4J_PASSWORD"`
-	DefaultPort   string `mapstructure:"DEFAULT_PORT"`
+	Neo4jUri        string `mapstructure:"NEO4J_URI"`
+	Neo4jUser       string `mapstructure:"NEO4J_USER"`
+	Neo4jPassword   string `mapstructure:"NEO4J_PASSWORD" secret:"true"`
+	DefaultPort     string `mapstructure:"DEFAULT_PORT"`
+	ComplexityLimit int    `mapstructure:"COMPLEXITY_LIMIT"`
+	MaxQueryDepth   int    `mapstructure:"MAX_QUERY_DEPTH"`
+
+	// Listener, a Unix socket replaces the TCP address and TLS applies to either
+	BindAddress string `mapstructure:"BIND_ADDRESS"`
+	UnixSocket  string `mapstructure:"UNIX_SOCKET"`
+	TlsCertFile string `mapstructure:"TLS_CERT_FILE"`
+	TlsKeyFile  string `mapstructure:"TLS_KEY_FILE"`
+
+	// Authentication, without a JWT secret every request belongs to the default institution and has no role,
+	// so admin only fields (userHistory, revertUser, graphAnalytics) can't be used. Nodes written before
+	// institutions existed are assigned to the default institution at start up.
+	AuthJwtSecret      string `mapstructure:"AUTH_JWT_SECRET" secret:"true"`
+	DefaultInstitution string `mapstructure:"DEFAULT_INSTITUTION"`
+
+	// Deployment environment, one of development, staging or production
+	Environment string `mapstructure:"ENVIRONMENT"`
+	CorsOrigins string `mapstructure:"CORS_ORIGINS"`
+
+	// Longest time a single Cypher transaction may run
+	QueryTimeout time.Duration `mapstructure:"QUERY_TIMEOUT"`
+
+	// How long graph analytics are reused before the graph is analysed again, zero until refreshed
+	AnalyticsCacheTtl time.Duration `mapstructure:"ANALYTICS_CACHE_TTL"`
+
+	// How long the response to a mutation with an idempotency key is returned to its retries
+	IdempotencyKeyTtl time.Duration `mapstructure:"IDEMPOTENCY_KEY_TTL"`
+
+	// Neo4j driver, encryption is one of uri, off, system or trust-all
+	Neo4jDatabase                     string        `mapstructure:"NEO4J_DATABASE"`
+	Neo4jMaxConnectionPoolSize        int           `mapstructure:"NEO4J_MAX_CONNECTION_POOL_SIZE"`
+	Neo4jConnectionAcquisitionTimeout time.Duration `mapstructure:"NEO4J_CONNECTION_ACQUISITION_TIMEOUT"`
+	Neo4jMaxConnectionLifetime        time.Duration `mapstructure:"NEO4J_MAX_CONNECTION_LIFETIME"`
+	Neo4jEncryption                   string        `mapstructure:"NEO4J_ENCRYPTION"`
+	Neo4jCaCertFile                   string        `mapstructure:"NEO4J_CA_CERT_FILE"`
+
+	// Retries of transient failures and the circuit breaker that stops them while Neo4j is down
+	Neo4jRetryAttempts       int           `mapstructure:"NEO4J_RETRY_ATTEMPTS"`
+	Neo4jRetryInitialBackoff time.Duration `mapstructure:"NEO4J_RETRY_INITIAL_BACKOFF"`
+	Neo4jRetryMaxBackoff     time.Duration `mapstructure:"NEO4J_RETRY_MAX_BACKOFF"`
+	Neo4jBreakerThreshold    int           `mapstructure:"NEO4J_BREAKER_THRESHOLD"`
+	Neo4jBreakerCooldown     time.Duration `mapstructure:"NEO4J_BREAKER_COOLDOWN"`
+
+	// Health checks and shutdown
+	ReadinessTimeout   time.Duration `mapstructure:"READINESS_TIMEOUT"`
+	ShutdownDrainDelay time.Duration `mapstructure:"SHUTDOWN_DRAIN_DELAY"`
+	ShutdownTimeout    time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`
+
+	// Logging, format is json or logfmt
+	LogFormat string `mapstructure:"LOG_FORMAT"`
+	LogLevel  string `mapstructure:"LOG_LEVEL"`
+
+	// Tracing, exporter is one of none, stdout or otlp
+	TracingExporter string `mapstructure:"TRACING_EXPORTER"`
+	OtlpEndpoint    string `mapstructure:"OTLP_ENDPOINT"`
+	OtlpInsecure    bool   `mapstructure:"OTLP_INSECURE"`
+	ServiceName     string `mapstructure:"SERVICE_NAME"`
+
+	// Persisted queries, cache is one of memory, file or none. The size caps the queries kept by either cache.
+	PersistedQueryCache     string `mapstructure:"PERSISTED_QUERY_CACHE"`
+	PersistedQueryCacheSize int    `mapstructure:"PERSISTED_QUERY_CACHE_SIZE"`
+	PersistedQueryDir       string `mapstructure:"PERSISTED_QUERY_DIR"`
+	OperationAllowList      string `mapstructure:"OPERATION_ALLOW_LIST"`
+	StrictOperations        bool   `mapstructure:"STRICT_OPERATIONS"`
 }
 
-// LoadConfig reads configuration from file or environment variables.
-func LoadConfig(path string) (config Config, err error) {
+// LoadConfig reads configuration in layers, defaults then the optional app.env file then environment variables
+// then command line flags, each layer overriding the one before. Any setting can instead be read from the file
+// named by its _FILE variant, e.g. NEO4J_PASSWORD_FILE for a mounted secret.
+// The config is returned even when it fails validation so it can still be printed.
+func LoadConfig(path string, flags *pflag.FlagSet) (config Config, err error) {
 	viper.AddConfigPath(path)
 	viper.SetConfigName("app")
 	viper.SetConfigType("env")
 
+	// Connection
+	viper.SetDefault("NEO4J_URI", "")
+	viper.SetDefault("NEO4J_USER", "")
+	viper.SetDefault("NEO4J_PASSWORD", "")
+	viper.SetDefault("DEFAULT_PORT", "8080")
+
+	// Listener
+	viper.SetDefault("BIND_ADDRESS", "")
+	viper.SetDefault("UNIX_SOCKET", "")
+	viper.SetDefault("TLS_CERT_FILE", "")
+	viper.SetDefault("TLS_KEY_FILE", "")
+
+	// Authentication
+	viper.SetDefault("AUTH_JWT_SECRET", "")
+	viper.SetDefault("DEFAULT_INSTITUTION", "")
+
+	// Deployment environment
+	viper.SetDefault("ENVIRONMENT", Development)
+	viper.SetDefault("CORS_ORIGINS", "")
+
+	// Query limits
+	viper.SetDefault("COMPLEXITY_LIMIT", 1000)
+	viper.SetDefault("MAX_QUERY_DEPTH", 10)
+
+	// Database
+	viper.SetDefault("QUERY_TIMEOUT", "10s")
+	viper.SetDefault("NEO4J_DATABASE", "")
+	viper.SetDefault("NEO4J_MAX_CONNECTION_POOL_SIZE", 100)
+	viper.SetDefault("NEO4J_CONNECTION_ACQUISITION_TIMEOUT", "1m")
+	viper.SetDefault("NEO4J_MAX_CONNECTION_LIFETIME", "1h")
+	viper.SetDefault("NEO4J_ENCRYPTION", "uri")
+	viper.SetDefault("NEO4J_CA_CERT_FILE", "")
+	viper.SetDefault("NEO4J_RETRY_ATTEMPTS", 3)
+	viper.SetDefault("NEO4J_RETRY_INITIAL_BACKOFF", "100ms")
+	viper.SetDefault("NEO4J_RETRY_MAX_BACKOFF", "2s")
+	viper.SetDefault("NEO4J_BREAKER_THRESHOLD", 5)
+	viper.SetDefault("NEO4J_BREAKER_COOLDOWN", "30s")
+	viper.SetDefault("ANALYTICS_CACHE_TTL", "15m")
+	viper.SetDefault("IDEMPOTENCY_KEY_TTL", "24h")
+
+	// Health checks and shutdown
+	viper.SetDefault("READINESS_TIMEOUT", "2s")
+	viper.SetDefault("SHUTDOWN_DRAIN_DELAY", "5s")
+	viper.SetDefault("SHUTDOWN_TIMEOUT", "30s")
+
+	// Logging
+	viper.SetDefault("LOG_FORMAT", "json")
+	viper.SetDefault("LOG_LEVEL", "info")
+
+	// Tracing
+	viper.SetDefault("TRACING_EXPORTER", "none")
+	viper.SetDefault("OTLP_ENDPOINT", "localhost:4318")
+	viper.SetDefault("OTLP_INSECURE", false)
+	viper.SetDefault("SERVICE_NAME", "coact-api")
+
+	// Persisted queries
+	viper.SetDefault("PERSISTED_QUERY_CACHE", "memory")
+	viper.SetDefault("PERSISTED_QUERY_CACHE_SIZE", 100)
+	viper.SetDefault("PERSISTED_QUERY_DIR", "persisted-queries")
+	viper.SetDefault("OPERATION_ALLOW_LIST", "")
+	viper.SetDefault("STRICT_OPERATIONS", false)
+
 	viper.AutomaticEnv()
 
+	// The file is optional, everything may be set in the environment
 	err = viper.ReadInConfig()
 	if err != nil {
-		return
+		if _, notFound := err.(viper.ConfigFileNotFoundError); !notFound {
+			return config, fmt.Errorf("cannot read config file: %w", err)
+		}
+	}
+
+	for _, field := range configFields() {
+		// Flags are the top layer
+		if flags != nil {
+			if flag := flags.Lookup(flagName(field.key)); flag != nil {
+				if err = viper.BindPFlag(field.key, flag); err != nil {
+					return config, err
+				}
+				if flag.Changed {
+					continue
+				}
+			}
+		}
+
+		// A secret file stands in for the environment variable
+		if secretPath := os.Getenv(field.key + "_FILE"); secretPath != "" {
+			if _, set := os.LookupEnv(field.key); set {
+				return config, fmt.Errorf("%s and %s_FILE are both set, use one", field.key, field.key)
+			}
+			secret, readErr := ioutil.ReadFile(secretPath)
+			if readErr != nil {
+				return config, fmt.Errorf("cannot read %s_FILE: %w", field.key, readErr)
+			}
+			viper.Set(field.key, strings.TrimRight(string(secret), "\r\n"))
+		}
 	}
 
 	err = viper.Unmarshal(&config)
+	if err != nil {
+		return config, fmt.Errorf("cannot decode config: %w", err)
+	}
+
+	err = config.Validate()
 	return
 }
+
+// NewFlagSet returns a flag for every setting, named in lower case with dashes e.g. --neo4j-uri
+func NewFlagSet(name string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+
+	for _, field := range configFields() {
+		flags.String(flagName(field.key), "", "overrides "+field.key)
+	}
+
+	return flags
+}
+
+// Print writes the effective config in app.env format with secrets redacted
+func (c Config) Print(w io.Writer) error {
+	value := reflect.ValueOf(c)
+
+	for _, field := range configFields() {
+		setting := fmt.Sprintf("%v", value.Field(field.index).Interface())
+		if field.secret && setting != "" {
+			setting = "********"
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", field.key, setting); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// configField describes one setting in Config
+type configField struct {
+	key    string
+	index  int
+	secret bool
+}
+
+// configFields lists the settings in declaration order from the Config struct tags
+func configFields() []configField {
+	configType := reflect.TypeOf(Config{})
+	fields := make([]configField, 0, configType.NumField())
+
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		fields = append(fields, configField{
+			key:    field.Tag.Get("mapstructure"),
+			index:  i,
+			secret: field.Tag.Get("secret") == "true",
+		})
+	}
+
+	return fields
+}
+
+func flagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
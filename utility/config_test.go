@@ -0,0 +1,132 @@
+package utility
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// setenv sets an environment variable for the rest of the test
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+
+	previous, set := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if set {
+			_ = os.Setenv(key, previous)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+// configDir writes an app.env with the given lines and resets viper, which LoadConfig configures globally
+func configDir(t *testing.T, lines ...string) string {
+	t.Helper()
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.env"), []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	dir := configDir(t,
+		"NEO4J_URI=bolt://file:7687",
+		"NEO4J_USER=file",
+		"DEFAULT_INSTITUTION=file",
+		"COMPLEXITY_LIMIT=50",
+		"MAX_QUERY_DEPTH=5",
+	)
+
+	setenv(t, "NEO4J_USER", "env")
+	setenv(t, "COMPLEXITY_LIMIT", "60")
+
+	secret := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(secret, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	setenv(t, "NEO4J_PASSWORD_FILE", secret)
+
+	flags := NewFlagSet("test")
+	if err := flags.Parse([]string{"--complexity-limit=70"}); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(dir, flags)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"default", config.LogFormat, "json"},
+		{"file over default", config.MaxQueryDepth, 5},
+		{"file", config.Neo4jUri, "bolt://file:7687"},
+		{"environment over file", config.Neo4jUser, "env"},
+		{"flag over environment", config.ComplexityLimit, 70},
+		{"secret file without its newline", config.Neo4jPassword, "s3cret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigSecretFileConflict(t *testing.T) {
+	dir := configDir(t, "NEO4J_URI=bolt://file:7687", "NEO4J_USER=file", "DEFAULT_INSTITUTION=file")
+
+	setenv(t, "NEO4J_PASSWORD", "plain")
+	setenv(t, "NEO4J_PASSWORD_FILE", filepath.Join(dir, "app.env"))
+
+	if _, err := LoadConfig(dir, nil); err == nil || !strings.Contains(err.Error(), "NEO4J_PASSWORD_FILE") {
+		t.Errorf("LoadConfig() error = %v, want the conflict reported", err)
+	}
+}
+
+func TestLoadConfigReturnsInvalidConfig(t *testing.T) {
+	dir := configDir(t, "NEO4J_USER=file", "DEFAULT_INSTITUTION=file")
+
+	config, err := LoadConfig(dir, nil)
+	if err == nil || !strings.Contains(err.Error(), "NEO4J_URI is required") {
+		t.Fatalf("LoadConfig() error = %v, want NEO4J_URI reported", err)
+	}
+	if config.Neo4jUser != "file" {
+		t.Errorf("the invalid config was not returned for printing, NEO4J_USER = %q", config.Neo4jUser)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	config := validConfig()
+	config.Neo4jPassword = "s3cret"
+
+	var printed strings.Builder
+	if err := config.Print(&printed); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(printed.String(), "s3cret") {
+		t.Error("Print() showed a secret")
+	}
+	if !strings.Contains(printed.String(), "NEO4J_PASSWORD=********\n") || !strings.Contains(printed.String(), "NEO4J_USER=neo4j\n") {
+		t.Errorf("Print() = %q", printed.String())
+	}
+}
@@ -0,0 +1,52 @@
+package utility
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Deployment environments selected with ENVIRONMENT
+const (
+	Development = "development"
+	Staging     = "staging"
+	Production  = "production"
+)
+
+// Policy is the set of behaviours that change between deployment environments
+type Policy struct {
+	Playground     bool
+	Introspection  bool
+	DetailedErrors bool
+	AllowedOrigins []string
+}
+
+// Policy returns the behaviour for the configured environment.
+// Development allows any origin unless CORS_ORIGINS is set, other environments only allow the listed origins.
+func (c Config) Policy() (Policy, error) {
+	origins := splitList(c.CorsOrigins)
+
+	switch c.Environment {
+	case Development:
+		if len(origins) == 0 {
+			origins = []string{"*"}
+		}
+		return Policy{Playground: true, Introspection: true, DetailedErrors: true, AllowedOrigins: origins}, nil
+	case Staging:
+		return Policy{Playground: true, Introspection: true, DetailedErrors: false, AllowedOrigins: origins}, nil
+	case Production:
+		return Policy{Playground: false, Introspection: false, DetailedErrors: false, AllowedOrigins: origins}, nil
+	}
+
+	return Policy{}, fmt.Errorf("ENVIRONMENT must be one of %s, %s or %s not %q", Development, Staging, Production, c.Environment)
+}
+
+// splitList splits a comma separated setting ignoring empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,104 @@
+package utility
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// neo4jSchemes are the URI schemes the Neo4j driver accepts
+var neo4jSchemes = []string{"neo4j", "neo4j+s", "neo4j+ssc", "bolt", "bolt+s", "bolt+ssc"}
+
+// Validate checks every setting and reports all the problems found in one error
+func (c Config) Validate() error {
+	var problems []string
+
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	// Connection
+	if c.Neo4jUri == "" {
+		problems = append(problems, "NEO4J_URI is required")
+	} else if uri, err := url.Parse(c.Neo4jUri); err != nil {
+		problems = append(problems, fmt.Sprintf("NEO4J_URI is not a valid URI: %v", err))
+	} else {
+		check(contains(neo4jSchemes, uri.Scheme), "NEO4J_URI scheme must be one of %s not %q", strings.Join(neo4jSchemes, ", "), uri.Scheme)
+	}
+	check(c.Neo4jUser != "", "NEO4J_USER is required")
+
+	// Neo4j driver
+	check(c.Neo4jMaxConnectionPoolSize > 0, "NEO4J_MAX_CONNECTION_POOL_SIZE must be greater than zero")
+	check(c.Neo4jConnectionAcquisitionTimeout > 0, "NEO4J_CONNECTION_ACQUISITION_TIMEOUT must be greater than zero")
+	check(c.Neo4jMaxConnectionLifetime > 0, "NEO4J_MAX_CONNECTION_LIFETIME must be greater than zero")
+	check(contains([]string{"uri", "off", "system", "trust-all"}, c.Neo4jEncryption), "NEO4J_ENCRYPTION must be uri, off, system or trust-all not %q", c.Neo4jEncryption)
+	verifiesServer := c.Neo4jEncryption == "system"
+	if uri, err := url.Parse(c.Neo4jUri); err == nil && c.Neo4jEncryption == "uri" {
+		verifiesServer = strings.HasSuffix(uri.Scheme, "+s")
+	}
+	check(c.Neo4jCaCertFile == "" || verifiesServer, "NEO4J_CA_CERT_FILE needs NEO4J_ENCRYPTION system or a +s URI scheme")
+
+	// Retries and circuit breaker
+	check(c.Neo4jRetryAttempts > 0, "NEO4J_RETRY_ATTEMPTS must be at least one")
+	check(c.Neo4jRetryInitialBackoff >= 0, "NEO4J_RETRY_INITIAL_BACKOFF must not be negative")
+	check(c.Neo4jRetryMaxBackoff >= c.Neo4jRetryInitialBackoff, "NEO4J_RETRY_MAX_BACKOFF must not be less than NEO4J_RETRY_INITIAL_BACKOFF")
+	check(c.Neo4jBreakerThreshold > 0, "NEO4J_BREAKER_THRESHOLD must be greater than zero")
+	check(c.Neo4jBreakerCooldown > 0, "NEO4J_BREAKER_COOLDOWN must be greater than zero")
+
+	// Listener
+	if c.UnixSocket == "" {
+		port, err := strconv.Atoi(c.DefaultPort)
+		check(err == nil && port > 0 && port < 65536, "DEFAULT_PORT must be a port number not %q", c.DefaultPort)
+	}
+	check((c.TlsCertFile == "") == (c.TlsKeyFile == ""), "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+
+	// Authentication
+	check(c.AuthJwtSecret != "" || c.Environment != Production, "AUTH_JWT_SECRET is required in production")
+	check(c.AuthJwtSecret != "" || c.DefaultInstitution != "", "DEFAULT_INSTITUTION is required when AUTH_JWT_SECRET is not set")
+
+	// Deployment environment
+	if _, err := c.Policy(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	// Query limits
+	check(c.ComplexityLimit > 0, "COMPLEXITY_LIMIT must be greater than zero")
+	check(c.MaxQueryDepth > 0, "MAX_QUERY_DEPTH must be greater than zero")
+
+	// Durations
+	check(c.QueryTimeout > 0, "QUERY_TIMEOUT must be greater than zero")
+	check(c.AnalyticsCacheTtl >= 0, "ANALYTICS_CACHE_TTL must not be negative")
+	check(c.IdempotencyKeyTtl > 0, "IDEMPOTENCY_KEY_TTL must be positive")
+	check(c.ReadinessTimeout > 0, "READINESS_TIMEOUT must be greater than zero")
+	check(c.ShutdownDrainDelay >= 0, "SHUTDOWN_DRAIN_DELAY must not be negative")
+	check(c.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be greater than zero")
+
+	// Logging and tracing
+	check(contains([]string{"json", "logfmt"}, c.LogFormat), "LOG_FORMAT must be json or logfmt not %q", c.LogFormat)
+	check(contains([]string{"none", "stdout", "otlp"}, c.TracingExporter), "TRACING_EXPORTER must be none, stdout or otlp not %q", c.TracingExporter)
+	check(c.TracingExporter != "otlp" || c.OtlpEndpoint != "", "OTLP_ENDPOINT is required when TRACING_EXPORTER is otlp")
+
+	// Persisted queries
+	check(contains([]string{"memory", "file", "none"}, c.PersistedQueryCache), "PERSISTED_QUERY_CACHE must be memory, file or none not %q", c.PersistedQueryCache)
+	check(c.PersistedQueryCache == "none" || c.PersistedQueryCacheSize > 0, "PERSISTED_QUERY_CACHE_SIZE must be greater than zero")
+	check(c.PersistedQueryCache != "file" || c.PersistedQueryDir != "", "PERSISTED_QUERY_DIR is required when PERSISTED_QUERY_CACHE is file")
+	check(!c.StrictOperations || c.OperationAllowList != "", "OPERATION_ALLOW_LIST is required when STRICT_OPERATIONS is true")
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
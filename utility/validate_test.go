@@ -0,0 +1,99 @@
+package utility
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig is a development config that passes validation
+func validConfig() Config {
+	return Config{
+		Neo4jUri:                          "bolt://localhost:7687",
+		Neo4jUser:                         "neo4j",
+		DefaultPort:                       "8080",
+		ComplexityLimit:                   1000,
+		MaxQueryDepth:                     10,
+		DefaultInstitution:                "default",
+		Environment:                       Development,
+		QueryTimeout:                      10 * time.Second,
+		AnalyticsCacheTtl:                 15 * time.Minute,
+		IdempotencyKeyTtl:                 24 * time.Hour,
+		Neo4jMaxConnectionPoolSize:        100,
+		Neo4jConnectionAcquisitionTimeout: time.Minute,
+		Neo4jMaxConnectionLifetime:        time.Hour,
+		Neo4jEncryption:                   "uri",
+		Neo4jRetryAttempts:                3,
+		Neo4jRetryInitialBackoff:          100 * time.Millisecond,
+		Neo4jRetryMaxBackoff:              2 * time.Second,
+		Neo4jBreakerThreshold:             5,
+		Neo4jBreakerCooldown:              30 * time.Second,
+		ReadinessTimeout:                  2 * time.Second,
+		ShutdownDrainDelay:                5 * time.Second,
+		ShutdownTimeout:                   30 * time.Second,
+		LogFormat:                         "json",
+		LogLevel:                          "info",
+		TracingExporter:                   "none",
+		PersistedQueryCache:               "memory",
+		PersistedQueryCacheSize:           100,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   string
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"missing uri", func(c *Config) { c.Neo4jUri = "" }, "NEO4J_URI is required"},
+		{"wrong scheme", func(c *Config) { c.Neo4jUri = "http://localhost:7474" }, "NEO4J_URI scheme"},
+		{"bad port", func(c *Config) { c.DefaultPort = "http" }, "DEFAULT_PORT"},
+		{"socket needs no port", func(c *Config) { c.DefaultPort = ""; c.UnixSocket = "/run/api.sock" }, ""},
+		{"certificate without key", func(c *Config) { c.TlsCertFile = "cert.pem" }, "TLS_CERT_FILE and TLS_KEY_FILE"},
+		{"production needs a secret", func(c *Config) { c.Environment = Production }, "AUTH_JWT_SECRET is required in production"},
+		{"no secret needs an institution", func(c *Config) { c.DefaultInstitution = "" }, "DEFAULT_INSTITUTION"},
+		{"unknown environment", func(c *Config) { c.Environment = "test" }, "ENVIRONMENT must be"},
+		{"ca without verification", func(c *Config) { c.Neo4jCaCertFile = "ca.pem" }, "NEO4J_CA_CERT_FILE"},
+		{"ca with a +s scheme", func(c *Config) { c.Neo4jCaCertFile = "ca.pem"; c.Neo4jUri = "neo4j+s://db:7687" }, ""},
+		{"backoff out of order", func(c *Config) { c.Neo4jRetryMaxBackoff = time.Millisecond }, "NEO4J_RETRY_MAX_BACKOFF"},
+		{"no idempotency ttl", func(c *Config) { c.IdempotencyKeyTtl = 0 }, "IDEMPOTENCY_KEY_TTL"},
+		{"otlp without endpoint", func(c *Config) { c.TracingExporter = "otlp" }, "OTLP_ENDPOINT"},
+		{"strict without allow-list", func(c *Config) { c.StrictOperations = true }, "OPERATION_ALLOW_LIST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig()
+			tt.change(&config)
+
+			err := config.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Validate() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	config := validConfig()
+	config.Neo4jUser = ""
+	config.ComplexityLimit = 0
+	config.LogFormat = "xml"
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("Validate() accepted an invalid config")
+	}
+	for _, want := range []string{"NEO4J_USER", "COMPLEXITY_LIMIT", "LOG_FORMAT"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error %q does not mention %s", err, want)
+		}
+	}
+}